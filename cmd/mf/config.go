@@ -8,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"strings"
@@ -44,21 +45,35 @@ func NewConfig(fs *pflag.FlagSet) (*Config, error) {
 		`Config file.
 example:
 
-# root directories (default: [.])
+# roots (default: [.])
 root:
   - ROOT1
+  - zip://ROOT2.zip
 # shell command (default: [sh])
 sh:
   - bash
 probe:
   - ffprobe -v error -hide_banner -show_entries format -of json=c=1 @ARG
 expr: |
-  name matches '\.m4a$'`)
+  name matches '\.m4a$'
+# named sets of name patterns for exclude-preset
+presets:
+  media-junk:
+    - "*.nfo"
+    - .thumbnails
+# metadata computed by expr lang after probe, in the order of the names
+fields:
+  minutes: p0.format.duration / 60`)
 
 	if err := fs.Parse(os.Args); err != nil {
 		return nil, err
 	}
 
+	// presets and fields are available only in the config file
+	var (
+		presets map[string][]string
+		fields  map[string]string
+	)
 	config, err := structconfig.NewBuilder(sc, NewConfigMerger()).
 		Add(func(sc *structconfig.StructConfig[Config]) (*Config, error) {
 			var x Config
@@ -72,6 +87,8 @@ expr: |
 			if err := (&x).parse(file); err != nil {
 				return nil, err
 			}
+			presets = x.Presets
+			fields = x.Fields
 			return &x, nil
 		}).
 		Add(func(sc *structconfig.StructConfig[Config]) (*Config, error) {
@@ -92,6 +109,8 @@ expr: |
 	if err != nil {
 		return nil, err
 	}
+	config.Presets = presets
+	config.Fields = fields
 	if err := config.Init(); err != nil {
 		return nil, err
 	}
@@ -116,22 +135,53 @@ func (c *Config) parse(v string) error {
 }
 
 type Config struct {
-	Debug     bool     `json:"debug" yaml:"debug" name:"debug" usage:"Enable debug logs"`
-	Quiet     bool     `json:"quiet" yaml:"quiet" name:"quiet" short:"q" usage:"Quiet logs except ERROR"`
-	Verbose   bool     `json:"verbose" yaml:"verbose" name:"verbose" short:"v" usage:"Verbose output. Output metadata to stdout and metrics to stderr"`
-	Worker    int      `json:"worker" yaml:"worker" name:"worker" short:"w" default:"8" usage:"Worker num"`
-	Out       string   `json:"out" yaml:"out" name:"out" short:"o" usage:"Output file. - means stdout"`
-	Root      []string `json:"root" yaml:"root" name:"root" short:"r" default:"." usage:"Root directories. - means stdin; separated by ';'"`
-	ZRoot     []string `json:"zroot" yaml:"zroot" name:"zroot" short:"z" usage:"Zip files: separated by ':'"`
-	Shell     []string `json:"shell" yaml:"shell" name:"sh" default:"sh" usage:"Shell command for probe; separated by ';'"`
-	Probe     []string `json:"probe" yaml:"probe" name:"probe" short:"p" usage:"Probe script. The script should write json to stdout, called by passing the filepath as the 1st argument. Read script from FILE by '@FILE'; separated by '#'"`
-	ProbeName []string `json:"pname" yaml:"pname" name:"pname" usage:"Probe script name. Change metadata name; separated by ';'"`
-	Index     []string `json:"index" yaml:"index" name:"index" short:"i" usage:"Read metadata from the specified files instead of scanning the directory. Read metadata from stdin by -; separated by ';'"`
-	Expr      string   `json:"expr" yaml:"expr" name:"expr" short:"e" usage:"Expression of expr lang to select entries. Read expr from FILE by '@FILE'"`
-	Exclude   string   `json:"exclude" yaml:"exclude" name:"exclude" short:"x" usage:"Expression of expr lang to reject entries before probe. Read expr from FILE by '@FILE'"`
-	Format    string   `json:"format" yaml:"format" name:"format" short:"f" usage:"Expression of expr lang to format output. Read expr from FILE by '@FILE'"`
-
-	formatExpr expr.RawExpr `json:"-" yaml:"-" name:"-"`
+	Debug         bool     `json:"debug" yaml:"debug" name:"debug" usage:"Enable debug logs"`
+	Quiet         bool     `json:"quiet" yaml:"quiet" name:"quiet" short:"q" usage:"Quiet logs except ERROR"`
+	Verbose       bool     `json:"verbose" yaml:"verbose" name:"verbose" short:"v" usage:"Verbose output. Output metadata to stdout and metrics to stderr"`
+	Worker        int      `json:"worker" yaml:"worker" name:"worker" short:"w" default:"8" usage:"Worker num"`
+	WalkWorker    int      `json:"walk_worker" yaml:"walk_worker" name:"walk-worker" default:"1" usage:"Number of goroutines to read directories in parallel within a root"`
+	Out           string   `json:"out" yaml:"out" name:"out" short:"o" usage:"Output file. - means stdout"`
+	Root          []string `json:"root" yaml:"root" name:"root" short:"r" usage:"Roots; . if neither root, zroot nor troot is given. file://DIR (or DIR), zip://FILE, tar://FILE, ar://FILE, iso://FILE, image://DIR_OR_FILE (OCI image layout or docker save tarball), git://REPO@REV (REV is HEAD if omitted; the probes read the content from stdin), index://FILE, - means stdin; separated by ';'"`
+	ZRoot         []string `json:"zroot" yaml:"zroot" name:"zroot" short:"z" usage:"Zip files; separated by ';'"`
+	TRoot         []string `json:"troot" yaml:"troot" name:"troot" short:"t" usage:"Tar files (tar, tar.gz, tar.bz2, tar.xz, tar.zst); separated by ';'"`
+	NestDepth     int      `json:"nest_depth" yaml:"nest_depth" name:"nest-depth" usage:"Max depth to descend into archives in archives (zip, jar, war, ear, whl, apk, tar, tar.gz, tar.bz2, tar.xz, tar.zst, ar, deb, iso); 0 disables"`
+	Deb           bool     `json:"deb" yaml:"deb" name:"deb" usage:"Walk the files in data.tar of deb packages instead of the files in the packages, adding the fields of the control file"`
+	NestSize      int64    `json:"nest_size" yaml:"nest_size" name:"nest-size" default:"67108864" usage:"Max size (in bytes) of nested archive to buffer in memory; larger ones are spilled to temporary files"`
+	Shell         []string `json:"shell" yaml:"shell" name:"sh" default:"sh" usage:"Shell command for probe; separated by ';'"`
+	Probe         []string `json:"probe" yaml:"probe" name:"probe" short:"p" usage:"Probe script. The script should write json to stdout, called by passing the filepath as the 1st argument. Read script from FILE by '@FILE'; separated by '#'"`
+	ProbeName     []string `json:"pname" yaml:"pname" name:"pname" usage:"Probe script name. Change metadata name; separated by ';'"`
+	Index         []string `json:"index" yaml:"index" name:"index" short:"i" usage:"Read metadata from the specified files instead of scanning the directory. Read metadata from stdin by -; separated by ';'"`
+	Expr          string   `json:"expr" yaml:"expr" name:"expr" short:"e" usage:"Expression of expr lang to select entries. Read expr from FILE by '@FILE'"`
+	Exclude       string   `json:"exclude" yaml:"exclude" name:"exclude" short:"x" usage:"Expression of expr lang to reject entries before probe. Read expr from FILE by '@FILE'"`
+	Archive       string   `json:"archive" yaml:"archive" name:"archive" short:"a" usage:"Expression of expr lang to select archive files (zip, jar, war, ear, whl, apk, tar, tar.gz, tar.bz2, tar.xz, tar.zst, ar, deb, iso) under root to walk as directories. Read expr from FILE by '@FILE'"`
+	MinDepth      int      `json:"mindepth" yaml:"mindepth" name:"mindepth" usage:"Do not output the files at depth less than this; the root is at depth 0"`
+	MaxDepth      int      `json:"maxdepth" yaml:"maxdepth" name:"maxdepth" default:"-1" usage:"Do not descend the directories at depth greater than or equal to this; negative means no limit"`
+	ExcludePreset []string `json:"exclude_preset" yaml:"exclude_preset" name:"exclude-preset" usage:"Skip the files and the directories by the name patterns of the presets before exclude: vcs, deps, caches, os-junk or defined in the config file; separated by ','"`
+	Gitignore     string   `json:"gitignore" yaml:"gitignore" name:"gitignore" usage:"Read .gitignore, .ignore and .git/info/exclude of the repositories of roots, and skip .git. prune skips the ignored files, mark outputs them with ignored field"`
+	Follow        bool     `json:"follow" yaml:"follow" name:"follow" short:"L" usage:"Follow symlinks. The directory loops are reported as errors"`
+	Xattr         bool     `json:"xattr" yaml:"xattr" name:"xattr" usage:"Read the extended attributes into xattr (linux)"`
+	XattrPrefix   string   `json:"xattr_prefix" yaml:"xattr_prefix" name:"xattr-prefix" usage:"Read only the extended attributes whose names start with the prefix, e.g. user."`
+	XattrSet      string   `json:"xattr_set" yaml:"xattr_set" name:"xattr-set" usage:"Name of the extended attribute to write on each selected file on the file system, not in archives, compressed files, git repositories nor index, e.g. user.project (linux)"`
+	XattrValue    string   `json:"xattr_value" yaml:"xattr_value" name:"xattr-value" usage:"Expression of expr lang to compute the value of xattr-set. Strings are written as is, others as json, nothing is written if nil. Read expr from FILE by '@FILE'"`
+	Xdev          bool     `json:"xdev" yaml:"xdev" name:"xdev" usage:"Stay on the device of each root, not descending into the directories on the other file systems"`
+	Dirs          bool     `json:"dirs" yaml:"dirs" name:"dirs" usage:"Output the directories with entry_count, file_count, subdir_count, total_size and newest_mod_time after walking their subtrees. They are the counts of the walked entries, not counting the ones rejected by exclude, gitignore, prune and local-config. The directories not descended by maxdepth or xdev have no counts"`
+	Parent        bool     `json:"parent" yaml:"parent" name:"parent" usage:"Add parent, the metadata of the directory of each file"`
+	ParentMarker  []string `json:"parent_marker" yaml:"parent_marker" name:"parent-marker" usage:"Name patterns to set parent.markers, e.g. README*; separated by ';'"`
+	Null          bool     `json:"null" yaml:"null" name:"null" short:"0" usage:"Read the paths from stdin separated by NUL instead of newline, e.g. find -print0"`
+	StdinJSON     bool     `json:"stdin_json" yaml:"stdin_json" name:"stdin-json" usage:"Read json objects from stdin instead of paths. path is the path, the other fields are added to the metadata without overwriting it. The objects having the fields telling what and where the file is, e.g. name and archive_chain, are rejected"`
+	Decompress    bool     `json:"decompress" yaml:"decompress" name:"decompress" usage:"Treat .gz and .bz2 files except tar under roots as wrapping one file. The probes of the file read the decompressed content from stdin"`
+	LocalConfig   bool     `json:"local_config" yaml:"local_config" name:"local-config" usage:"Read .mf.yaml in the directories under roots, adding exclude, probe, pname and fields to the subtrees. The inner ones take precedence. The probes are arbitrary shell commands, use only for the trusted directories"`
+	Dedup         string   `json:"dedup" yaml:"dedup" name:"dedup" usage:"De-duplicate the files reached from the different roots by path (real path) or inode (device and inode)"`
+	ErrorOut      string   `json:"error_out" yaml:"error_out" name:"error-out" usage:"Output file of the walk errors as jsonl. - means stderr. The errors are logged as warnings if not specified"`
+	ErrorEntry    bool     `json:"error_entry" yaml:"error_entry" name:"error-entry" usage:"Output the paths failed to walk as entries with error field instead of reporting the errors"`
+	Format        string   `json:"format" yaml:"format" name:"format" short:"f" usage:"Expression of expr lang to format output. Read expr from FILE by '@FILE'"`
+
+	Presets map[string][]string `json:"presets" yaml:"presets" name:"-"`
+	Fields  map[string]string   `json:"fields" yaml:"fields" name:"-"`
+
+	formatExpr     expr.RawExpr `json:"-" yaml:"-" name:"-"`
+	xattrValueExpr expr.RawExpr `json:"-" yaml:"-" name:"-"`
+	fields         []field      `json:"-" yaml:"-" name:"-"`
 }
 
 func (c *Config) Init() error {
@@ -147,6 +197,23 @@ func (c *Config) Init() error {
 		return err
 	}
 
+	xattrValueExpr, err := newRawExpr(c.XattrValue)
+	switch {
+	case err == nil:
+		c.xattrValueExpr = xattrValueExpr
+	case !errors.Is(err, errNotSpecified):
+		return err
+	}
+	if (c.XattrSet == "") != (c.xattrValueExpr == nil) {
+		return fmt.Errorf("%w: xattr-set and xattr-value should be specified together", errArgument)
+	}
+
+	fields, err := newFields(c.Fields, iox.ReadFileOrLiteral)
+	if err != nil {
+		return err
+	}
+	c.fields = fields
+
 	return nil
 }
 
@@ -164,7 +231,14 @@ func (Config) unmarshalCallback(f structconfig.StructField, v string, fv func()
 		xs := strings.Split(v, "#")
 		fv().Set(reflect.ValueOf(xs))
 		return nil
-	case "root", "sh", "index", "pname", "zroot":
+	case "exclude-preset":
+		if v == "" {
+			return nil
+		}
+		xs := strings.Split(v, ",")
+		fv().Set(reflect.ValueOf(xs))
+		return nil
+	case "root", "sh", "index", "pname", "zroot", "troot", "parent-marker":
 		if v == "" {
 			return nil
 		}
@@ -211,6 +285,13 @@ func (c Config) NewOutput() (io.WriteCloser, error) {
 	return iox.AsWriteCloser(os.Stdout), nil
 }
 
+func (c Config) NewErrorOutput() (io.WriteCloser, error) {
+	if c.ErrorOut == "" {
+		return nil, errNotSpecified
+	}
+	return iox.NewWriteCloser(os.Stderr, c.ErrorOut)
+}
+
 func (c Config) NewIndexReader() (iox.ReaderAndCloser, error) {
 	if len(c.Index) == 0 {
 		return nil, errNotSpecified
@@ -259,6 +340,14 @@ func (c *Config) NewExclude() (expr.Expr, error) {
 	return expr.New(x), nil
 }
 
+func (c *Config) NewArchive() (expr.Expr, error) {
+	x, err := newRawExpr(c.Archive)
+	if err != nil {
+		return nil, err
+	}
+	return expr.New(x), nil
+}
+
 func (c *Config) newFormat() (expr.RawExpr, error) { return newRawExpr(c.Format) }
 
 func (c *Config) newProbers() ([]meta.Prober, error) {
@@ -275,41 +364,126 @@ func (c *Config) newProbers() ([]meta.Prober, error) {
 	return xs, nil
 }
 
+func (c *Config) archiveOptions() []walk.ArchiveOption {
+	return []walk.ArchiveOption{
+		walk.WithNestDepth(c.NestDepth),
+		walk.WithNestSize(c.NestSize),
+		walk.WithDeb(c.Deb),
+	}
+}
+
 func (c *Config) NewRootWalker() (*iox.Walker, error) {
 	exclude, err := c.NewExclude()
 	if err != nil && !errors.Is(err, errNotSpecified) {
 		return nil, err
 	}
 
-	if args := c.ZRoot; len(args) > 0 {
-		w := walk.NewZip(exclude)
-		return iox.NewWalker(w, args...), nil
+	gitignore, err := walk.ParseGitignore(c.Gitignore)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errArgument, err)
 	}
 
-	args := c.Root
-	switch {
-	case len(args) == 0:
-		return nil, fmt.Errorf("%w: no roots", errArgument)
-	case !slices.Contains(args, iox.StdinMark):
-		w := walk.NewFile(exclude)
-		return iox.NewWalker(w, args...), nil
-	case len(args) == 1:
-		w := walk.NewReader(os.Stdin, walk.NewFile(exclude))
-		return iox.NewWalker(w, args...), nil
-	default:
-		return nil, fmt.Errorf("%w: no other files can be specifined using %s (stdin)",
-			errArgument,
-			iox.StdinMark,
-		)
+	prunePatterns, err := walk.ResolvePresets(c.ExcludePreset, c.Presets)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errArgument, err)
+	}
+	for _, x := range c.ParentMarker {
+		if _, err := filepath.Match(x, ""); err != nil {
+			return nil, fmt.Errorf("%w: %w: parent-marker %s", errArgument, walk.ErrBadPattern, x)
+		}
+	}
+
+	fileOpts := []walk.FileOption{
+		walk.WithErrorEntry(c.ErrorEntry),
+		walk.WithParallel(c.WalkWorker),
+		walk.WithFollowSymlinks(c.Follow),
+		walk.WithXattr(c.Xattr, c.XattrPrefix),
+		walk.WithXdev(c.Xdev),
+		walk.WithDepth(c.MinDepth, c.MaxDepth),
+		walk.WithGitignore(gitignore),
+		walk.WithPrune(prunePatterns),
+		walk.WithLocalConfig(c.LocalConfig),
+		walk.WithDirs(c.Dirs),
+		walk.WithParent(c.Parent, c.ParentMarker),
+		walk.WithDecompress(c.Decompress),
+	}
+	switch archive, err := c.NewArchive(); {
+	case err == nil:
+		fileOpts = append(fileOpts, walk.WithArchive(archive, c.archiveOptions()...))
+	case !errors.Is(err, errNotSpecified):
+		return nil, err
+	}
+
+	registry := walk.NewRegistry()
+	registry.Register(walk.SchemeFile, walk.NewFile(exclude, fileOpts...))
+	registry.Register(walk.SchemeZip, walk.NewZip(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeTar, walk.NewTar(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeAr, walk.NewAr(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeImage, walk.NewImage(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeISO, walk.NewISO(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeGit, walk.NewGit(exclude, c.archiveOptions()...))
+	registry.Register(walk.SchemeIndex, walk.NewIndex(exclude))
+	registry.Register(walk.SchemeStdin, walk.NewReader(os.Stdin, walk.NewFile(exclude, fileOpts...), walk.WithNull(c.Null), walk.WithJSON(c.StdinJSON)))
+
+	roots := c.roots()
+	var stdinCount int
+	for _, x := range roots {
+		if scheme, _ := walk.ParseRoot(x); scheme == walk.SchemeStdin {
+			stdinCount++
+		}
+	}
+	if stdinCount > 1 {
+		return nil, fmt.Errorf("%w: stdin (%s) can be specified only once", errArgument, iox.StdinMark)
+	}
+
+	dedup, err := walk.ParseDedup(c.Dedup)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errArgument, err)
+	}
+
+	return iox.NewWalker(walk.NewRegistryWalker(registry), roots, iox.WithDedup(dedup)), nil
+}
+
+// defaultRoot is the root when no roots are given.
+const defaultRoot = "."
+
+// roots returns the roots with schemes: root, zroot and troot.
+func (c *Config) roots() []string {
+	if len(c.Root) == 0 && len(c.ZRoot) == 0 && len(c.TRoot) == 0 {
+		return []string{defaultRoot}
+	}
+	roots := make([]string, 0, len(c.Root)+len(c.ZRoot)+len(c.TRoot))
+	roots = append(roots, c.Root...)
+	for _, x := range c.ZRoot {
+		roots = append(roots, walk.NewRoot(walk.SchemeZip, x))
 	}
+	for _, x := range c.TRoot {
+		roots = append(roots, walk.NewRoot(walk.SchemeTar, x))
+	}
+	return roots
+}
+
+// references returns the costly metadata referred by expression, format, xattr-value and the fields.
+// All are referred if the metadata are dumped by verbose, or the local configs may refer to them.
+func (c *Config) references(expression expr.Expr) walk.References {
+	if c.Verbose || c.LocalConfig {
+		return walk.AllReferences
+	}
+	xs := []any{expression, c.formatExpr, c.xattrValueExpr}
+	for _, f := range c.fields {
+		xs = append(xs, f.expr)
+	}
+	return walk.ReferencesOf(xs...)
 }
 
-func (c *Config) NewEntryWorker() *worker.Worker[walk.Entry, *meta.Data] {
+// NewEntryWorker returns the worker to compute the metadata of the entries for expression.
+func (c *Config) NewEntryWorker(expression expr.Expr) *worker.Worker[walk.Entry, *meta.Data] {
+	refs := c.references(expression)
 	return worker.New(
 		"WalkMeta",
 		c.Worker,
 		func(_ context.Context, x walk.Entry) (*meta.Data, error) {
-			return walk.NewMetaData(x), nil
+			return walk.NewMetaDataOf(x, refs), nil
 		})
 }
 
@@ -337,13 +511,76 @@ func (c *Config) NewProberWorkersChain() (*worker.Chain[*meta.Data], error) {
 	if err != nil {
 		return nil, err
 	}
+	if w := c.newLocalWorker(); w != nil {
+		workers = append(workers, w)
+	}
 	return worker.NewChain(workers, c.Worker), nil
 }
 
 var (
-	AcceptCount = metric.NewCounter("Accept")
+	AcceptCount      = metric.NewCounter("Accept")
+	XattrSetCount    = metric.NewCounter("XattrSet")
+	XattrSetErrCount = metric.NewCounter("XattrSetErr")
 )
 
+// OutputError writes the error of the walk as json.
+func (c *Config) OutputError(w io.Writer, err error) {
+	data := walk.NewErrorMetadata(err)
+	var rootErr *iox.RootError
+	if errors.As(err, &rootErr) {
+		data.Set("root", rootErr.Root)
+		data.Set("error", rootErr.Err.Error())
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		slog.Warn("Marshal", logx.Err(err))
+		return
+	}
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// SetXattr writes the extended attribute computed from v to the file of v.
+func (c *Config) SetXattr(v *meta.Data) {
+	if c.xattrValueExpr == nil {
+		return
+	}
+
+	path := walk.GetPathFromMetadata(v)
+	if e, ok := walk.EntryOf(v); !ok || !walk.IsOnFileSystem(e) {
+		// virtual files, e.g. in the archives
+		slog.Debug("SetXattr: not on the file system", slog.String("path", path))
+		return
+	}
+	x, err := c.xattrValueExpr.Run(v.Unwrap())
+	if err != nil {
+		XattrSetErrCount.Incr()
+		slog.Warn("XattrValue", slog.String("path", path), logx.Err(err))
+		return
+	}
+	var value string
+	switch x := x.(type) {
+	case nil:
+		return
+	case string:
+		value = x
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			XattrSetErrCount.Incr()
+			slog.Warn("Marshal", slog.String("path", path), logx.Err(err))
+			return
+		}
+		value = string(b)
+	}
+
+	if err := walk.SetXattr(path, c.XattrSet, value); err != nil {
+		XattrSetErrCount.Incr()
+		slog.Warn("SetXattr", slog.String("path", path), logx.Err(err))
+		return
+	}
+	XattrSetCount.Incr()
+}
+
 func (c *Config) Output(w io.Writer, v *meta.Data) {
 	AcceptCount.Incr()
 
@@ -44,14 +44,34 @@ func find(ctx context.Context, c *Config) error {
 			if err != nil {
 				return err
 			}
-			entryC := walker.Start(ctx)
-			entryWorker := c.NewEntryWorker()
-			entryWorker.Start(ctx, entryC, inC)
-			defer func() {
-				if err := walker.Err(); err != nil {
+			errOut, err := c.NewErrorOutput()
+			switch {
+			case err == nil:
+				defer errOut.Close()
+			case !errors.Is(err, errNotSpecified):
+				return err
+			}
+			// the walker is canceled on return, not to block on the entries not read
+			// when failed to set up the rest
+			walkCtx, cancel := context.WithCancel(ctx)
+			entryC, errC := walker.Start(walkCtx)
+			entryWorker := c.NewEntryWorker(expression)
+			entryWorker.Start(walkCtx, entryC, inC)
+			errDone := make(chan struct{})
+			go func() {
+				defer close(errDone)
+				for err := range errC {
+					if errOut != nil {
+						c.OutputError(errOut, err)
+						continue
+					}
 					slog.Warn("RootWalker", logx.Err(err))
 				}
 			}()
+			defer func() {
+				cancel()
+				<-errDone
+			}()
 		default:
 			return err
 		}
@@ -63,9 +83,13 @@ func find(ctx context.Context, c *Config) error {
 	}
 	join.Start(ctx, inC, outC)
 
+	accept := func(x *meta.Data) {
+		c.Output(w, x)
+		c.SetXattr(x)
+	}
 	for x := range outC {
 		if !exprEnabled {
-			c.Output(w, x)
+			accept(x)
 			continue
 		}
 
@@ -77,7 +101,7 @@ func find(ctx context.Context, c *Config) error {
 		if !passed {
 			continue
 		}
-		c.Output(w, x)
+		accept(x)
 	}
 
 	return nil
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/iox"
+	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/meta"
+	"github.com/berquerant/metafind/metric"
+	"github.com/berquerant/metafind/prober"
+	"github.com/berquerant/metafind/syncx"
+	"github.com/berquerant/metafind/walk"
+	"github.com/berquerant/metafind/worker"
+)
+
+// field is the metadata computed by the expression.
+type field struct {
+	name string
+	expr expr.RawExpr
+}
+
+// newFields returns the fields in the order of the names.
+// readFile reads the expression from '@FILE'.
+func newFields(m map[string]string, readFile func(string) (string, error)) ([]field, error) {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	fields := make([]field, len(names))
+	for i, name := range names {
+		code, err := readFile(m[name])
+		if err != nil {
+			return nil, err
+		}
+		x, err := expr.NewRaw(code)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = field{
+			name: name,
+			expr: x,
+		}
+	}
+	return fields, nil
+}
+
+var (
+	FieldCount    = metric.NewCounter("Field")
+	FieldErrCount = metric.NewCounter("FieldErr")
+)
+
+// computeFields sets the fields to x.
+// The fields failed to compute are not set.
+func computeFields(fields []field, x *meta.Data) {
+	for _, f := range fields {
+		v, err := f.expr.Run(x.Unwrap())
+		if err != nil {
+			FieldErrCount.Incr()
+			slog.Warn("Field",
+				slog.String("name", f.name),
+				slog.String("path", walk.GetPathFromMetadata(x)),
+				logx.Err(err),
+			)
+			continue
+		}
+		FieldCount.Incr()
+		x.Set(f.name, v)
+	}
+}
+
+type namedProber struct {
+	name   string
+	prober meta.Prober
+}
+
+// localLayer is the probes and the fields of a local config.
+type localLayer struct {
+	probers []namedProber
+	fields  []field
+}
+
+// readLocalFileOrLiteral is iox.ReadFileOrLiteral but the relative path of '@FILE' is relative to dir.
+func readLocalFileOrLiteral(dir string) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if name, ok := strings.CutPrefix(s, iox.FileMark); ok && !filepath.IsAbs(name) {
+			s = iox.FileMark + filepath.Join(dir, name)
+		}
+		return iox.ReadFileOrLiteral(s)
+	}
+}
+
+func (c *Config) newLocalLayer(path string) (*localLayer, error) {
+	lc, err := walk.ReadLocalConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	read := readLocalFileOrLiteral(lc.Dir())
+	probers := make([]namedProber, len(lc.Probe))
+	for i, p := range lc.Probe {
+		code, err := read(p)
+		if err != nil {
+			return nil, err
+		}
+		probers[i] = namedProber{
+			name:   lc.ProbeNameAt(i),
+			prober: meta.NewScript(code, c.Shell[0], c.Shell[1:]...),
+		}
+	}
+	fields, err := newFields(lc.Fields, read)
+	if err != nil {
+		return nil, err
+	}
+	return &localLayer{
+		probers: probers,
+		fields:  fields,
+	}, nil
+}
+
+// localLayers are the local layers by the paths of the local configs.
+type localLayers struct {
+	c      *Config
+	layers sync.Map // path to *localLayer, nil if failed to load
+}
+
+func (l *localLayers) get(path string) *localLayer {
+	if x, ok := l.layers.Load(path); ok {
+		return x.(*localLayer)
+	}
+	layer, err := l.c.newLocalLayer(path)
+	if err != nil {
+		slog.Warn("LocalConfig", slog.String("path", path), logx.Err(err))
+		layer = nil
+	}
+	x, _ := l.layers.LoadOrStore(path, layer)
+	return x.(*localLayer)
+}
+
+// localConfigPaths returns the paths of the local configs applied to x by the walk, from the outermost.
+// They are not from the metadata, that may be given by the index or stdin-json, not to run the probes of any files.
+func localConfigPaths(x *meta.Data) []string {
+	e, ok := walk.EntryOf(x)
+	if !ok {
+		return nil
+	}
+	return e.LocalConfig()
+}
+
+// newLocalWorker returns the worker to run the probes of the local configs,
+// and to compute the fields of the config and the local configs.
+// Returns nil if there is nothing to do.
+func (c *Config) newLocalWorker() *worker.Worker[*meta.Data, *meta.Data] {
+	if !c.LocalConfig && len(c.fields) == 0 {
+		return nil
+	}
+	layers := &localLayers{
+		c: c,
+	}
+	return worker.New(
+		"Local",
+		c.Worker,
+		func(ctx context.Context, x *meta.Data) (*meta.Data, error) {
+			var locals []*localLayer
+			if c.LocalConfig {
+				for _, p := range localConfigPaths(x) {
+					if layer := layers.get(p); layer != nil {
+						locals = append(locals, layer)
+					}
+				}
+			}
+			for _, layer := range locals {
+				for _, p := range layer.probers {
+					if _, err := prober.AddData(ctx, p.name, p.prober, x); err != nil {
+						if syncx.IsDone(err) {
+							return nil, err
+						}
+						slog.Warn("LocalProbe",
+							slog.String("name", p.name),
+							slog.String("path", walk.GetPathFromMetadata(x)),
+							logx.Err(err),
+						)
+					}
+				}
+			}
+			computeFields(c.fields, x)
+			for _, layer := range locals {
+				computeFields(layer.fields, x)
+			}
+			return x, nil
+		})
+}
@@ -74,15 +74,102 @@ Available inputs:
 - mod_time: The last modification time of the file
 - mod_time_ts: The last modification timestamp of the file
 - mode: The file permissions (in octal)
+- perm: The permission bits, e.g. 0o644 (number)
+- type: The file type: regular, dir, symlink, socket, fifo, char, block or irregular
+- setuid: True if the setuid bit is set
+- setgid: True if the setgid bit is set
+- sticky: True if the sticky bit is set
+- exec_user: True if the owner can execute the file
+- world_writable: True if anyone can write the file
+- readable: True if the current user can read the file, checked by access(2)
+- writable: True if the current user can write the file, checked by access(2)
+- executable: True if the current user can execute the file, checked by access(2)
 - name: The name of the file
 - path: The path of the file
-- size: The file size (in bytes)
-- root: The zip file path (zroot)
-- relpath: The relative path of file in zip (zroot)
-- compressed_size: The compressed size of the file (in bytes, zroot)
-- uncompressed_size: The uncompressed size of the file (in bytes, zroot)
-- comment: The user-defined string (zroot)
-- non_utf8: If true, indicates relpath and comment are not encoded in UTF-8 (zroot)
+- size: The file size (in bytes); -1 for the file in bzip2 by 'decompress'
+- is_dir: True if the file is a directory
+- uid: The user id of owner (linux, troot, ar, image, iso, archive)
+- gid: The group id of owner (linux, troot, ar, image, iso, archive)
+- user: The user name of owner; empty if unknown (linux)
+- group: The group name of owner; empty if unknown (linux)
+- inode: The inode number (linux)
+- dev: The device number (linux)
+- nlink: The number of hard links (linux, iso)
+- blocks: The number of 512-byte blocks allocated (linux)
+- allocated_size: The allocated size (in bytes), less than size if sparse (linux)
+- atime: The last access time of the file (linux, iso)
+- atime_ts: The last access timestamp of the file (linux, iso)
+- ctime: The last status change time of the file (linux, iso)
+- ctime_ts: The last status change timestamp of the file (linux, iso)
+- btime: The creation time of the file, if the file system provides it (linux, iso)
+- btime_ts: The creation timestamp of the file, if the file system provides it (linux, iso)
+- source: The root that yielded the file
+- root: The root directory that yielded the file, or the directory read from stdin; the archive file path for the file in archive; the repository for git
+- relpath: The path relative to root; the relative path of file for the file in archive
+- depth: The number of components; 0 for the root itself
+- components: The array of the path components of relpath
+- is_symlink: True if the file is a symlink
+- link_target: The target of the symlink as written in the link
+- link_resolved: The real path of the symlink target; empty if broken
+- link_broken: True if the symlink target does not exist
+- ignored: True if the file is ignored by the gitignore files (gitignore)
+- ignore_rule: The last rule matching the file, e.g. "!keep.log"; empty if no rules match (gitignore)
+- ignore_source: The file and the line number of ignore_rule (gitignore)
+- mount_point: The mount point of the file system containing the file (linux)
+- fs_type: The type of the file system containing the file, e.g. "ext4" (linux)
+- mount_source: The source of the mount, e.g. "/dev/sda1" (linux)
+- xattr: The map of the extended attributes (xattr, linux)
+- entry_count: The number of the walked entries in the directory (dirs)
+- file_count: The number of the walked non-directory entries in the directory (dirs)
+- subdir_count: The number of the walked subdirectories in the directory (dirs)
+- total_size: The total size of the walked files under the directory, recursively (in bytes, dirs)
+- newest_mod_time: The last modification time of the directory and the entries under it, recursively (dirs)
+- newest_mod_time_ts: The last modification timestamp of the directory and the entries under it, recursively (dirs)
+- parent: The metadata of the directory of the file (parent)
+  - parent.path, parent.name: The path and the name of the directory
+  - parent.entry_count, parent.file_count, parent.subdir_count: The number of the entries in the directory
+  - parent.names: The array of the names of the entries in the directory, including the file
+  - parent.markers: The map from the patterns of 'parent-marker' to whether the entries matching them exist
+- *: The fields but path of the json objects read from stdin, not overwriting the metadata above (stdin-json); the objects having the fields telling what and where the file is, e.g. name, archive_chain and git_object, are rejected
+- local_config: The array of the paths of the local configs applied to the file, from the outermost (local-config)
+- error: The error message of the path failed to walk (error-entry)
+- errno: The errno of the error, e.g. 13 permission denied (error-entry)
+- op: The operation failed, e.g. "open" (error-entry)
+- compressed_size: The compressed size of the file (in bytes, zroot, archive, decompress)
+- uncompressed_size: The uncompressed size of the file (in bytes, zroot, archive, decompress); modulo 2^32 for gzip, absent for bzip2
+- comment: The user-defined string (zroot, archive, decompress)
+- non_utf8: If true, indicates relpath and comment are not encoded in UTF-8 (zroot, archive)
+- typeflag: The type of header entry, e.g. "0" regular, "2" symlink (troot, image, archive)
+- uname: The user name of owner (troot, image, archive)
+- gname: The group name of owner (troot, image, archive)
+- linkname: The target name of link (troot, image, iso, archive)
+- pax_records: The PAX extended header records (troot, image, archive)
+- deb_package: The Package field of the deb package shipping the file (deb)
+- deb_version: The Version field of the deb package (deb)
+- deb_architecture: The Architecture field of the deb package (deb)
+- deb_depends: The array of the dependencies in the Depends field of the deb package (deb)
+- deb_control: The map of all the fields of the control file of the deb package (deb)
+- deb_file: The path of the file installed by the deb package, e.g. "/usr/bin/foo" (deb)
+- image: The reference of the image containing the file, e.g. "alpine:3.20", or the digest of the manifest if unknown (image)
+- image_platform: The platform of the image, e.g. "linux/amd64"; empty if unknown (image)
+- layer_digest: The digest of the layer introducing the file (image)
+- layer_index: The index of the layer introducing the file; 0 for the base layer (image)
+- layer_shadowed: True if the file is overwritten or deleted by a later layer, so not in the final file system (image)
+- layer_shadowed_by: The digest of the layer overwriting or deleting the file; empty if not shadowed (image)
+- iso_extension: The extension of ISO9660 providing the names: rockridge, joliet or empty (iso)
+- recorded_time: The recording time of the directory record of the file (iso)
+- recorded_time_ts: The recording timestamp of the directory record of the file (iso)
+- git_repo: The path of the repository (git)
+- git_revision: The revision given by the root, e.g. "HEAD~3" (git)
+- git_commit: The commit id of the revision (git)
+- git_mode: The mode of the tree entry, e.g. "100755" executable, "120000" symlink (git)
+- git_type: The type of the object, "blob" or "commit" for submodule (git)
+- git_object: The object id of the file (git)
+- compression: The compression of the compressed file containing the file, gzip or bzip2 (decompress)
+- compressed_path: The compressed file containing the file (decompress)
+- archive_chain: The archives containing the file and relpath, separated by "!/" (zroot, troot, ar, image, iso, archive, decompress)
+- archive_parent: The innermost archive containing the file, in the same form as archive_chain (zroot, troot, ar, image, iso, archive, decompress)
+- archive_depth: The nesting level of archive_parent; 0 for the file in the archive itself (zroot, troot, ar, image, iso, archive, decompress)
 
 You can add inputs by specifying 'probe'.
 The 'probe' is invoked with the path to the target file (1st argument).
@@ -98,6 +185,32 @@ And the 'probe' must output a JSON string or in the form "key=value" to standard
   key2=value2
 
 The keys for the inputs available in the expression will be 'pN' for the N-th 'probe'.
+For the file in the compressed file by 'decompress', the 'probe' reads the decompressed content from stdin.
+For the file in the git repository by git://, the 'probe' reads the content of the blob from stdin.
+
+You can add inputs computed by Expr by 'fields' in the config file.
+The fields are computed after all the probes, in the order of the names.
+
+With 'local-config', .mf.yaml in each directory under the roots applies to the files under the directory:
+
+  # rejects the files under the directory, in addition to 'exclude'
+  exclude: ext == ".tmp"
+  # runs after 'probe'. @FILE is relative to the directory. The N-th unnamed probe is named 'lN'
+  probe:
+    - ffprobe -v error -show_entries format -of json=c=1 @ARG
+  pname:
+    - ff
+  # computed after 'fields'
+  fields:
+    minutes: ff.format.duration / 60
+
+The local configs are applied from the outermost directory to the innermost,
+so the probes and the fields of the inner ones overwrite the same names.
+
+WARNING: the probes of .mf.yaml are arbitrary shell commands run as the user,
+so anyone who can write a file under the roots can run commands by 'local-config'.
+Use it only for the trusted directories.
+The local configs are found only by walking the directories, not by local_config of the index or stdin-json.
 
 Examples:
 
@@ -115,14 +228,80 @@ Examples:
 %[1]s -r SOME_DIR -e 'key.p matches "green"' -p 'echo "p=@RAWARG"' --pname 'key'
 # Read paths from stdin
 echo SOME_DIR | %[1]s -r - -v
+# Read paths separated by NUL from stdin
+find SOME_DIR -name '*.mp3' -print0 | %[1]s -r - -0 -v
+# Read paths with metadata from stdin
+echo '{"path":"SOME_DIR","tag":"x"}' | %[1]s -r - --stdin-json -e 'tag == "x"'
+# Read directories in parallel
+%[1]s -r SOME_DIR --walk-worker 8
+# Report the paths failed to walk to file
+%[1]s -r SOME_DIR --error-out ERRORS_FILE
+# Search the paths failed to walk
+%[1]s -r SOME_DIR --error-entry -e 'errno == 13'
 # Read metadata
 %[1]s -i METADATA_FILE -e 'path matches "green"'
+# Mix roots of different kinds
+%[1]s -r 'SOME_DIR;zip://SOME.zip;tar://SOME.tar.gz;index://METADATA_FILE' -e 'path matches "green"'
+# Skip the junk directories
+%[1]s -r SOME_DIR --exclude-preset vcs,deps,caches,os-junk -e 'name matches "green"'
+# Skip the files ignored by git
+%[1]s -r SOME_DIR --gitignore prune -e 'name matches "green"'
+# Search the ignored files, but not under node_modules
+%[1]s -r SOME_DIR --gitignore mark -x 'is_dir && name == "node_modules"' -e 'ignored'
+# Search files exactly two levels below each root
+%[1]s -r 'SOME_DIR;OTHER_DIR' --mindepth 2 --maxdepth 2
+# Stay on the file system of the root
+%[1]s -r / --xdev -e 'name matches "green"'
+# Skip network and memory file systems
+%[1]s -r / -x 'is_dir && fs_type in ["nfs", "tmpfs"]' -e 'name matches "green"'
+# Search by extended attribute
+%[1]s -r SOME_DIR --xattr --xattr-prefix user. -e 'xattr["user.project"] == "x"'
+# Tag files by extended attribute
+%[1]s -r SOME_DIR -e 'ext == ".mp3"' --xattr-set user.project --xattr-value '"x"'
+# Search world writable files without sticky bit
+%[1]s -r SOME_DIR -e 'world_writable && !sticky'
+# Search sparse files
+%[1]s -r SOME_DIR -e 'allocated_size < size'
+# Search broken symlinks
+%[1]s -r SOME_DIR -e 'link_broken'
+# Search through linked directories
+%[1]s -r SOME_DIR -L -e 'name matches "green"'
+# Search empty directories
+%[1]s -r SOME_DIR --dirs -e 'is_dir && entry_count == 0'
+# Search directories with more than 10k files
+%[1]s -r SOME_DIR --dirs -e 'is_dir && file_count > 10000' -f '{path:path,files:file_count,size:total_size}'
+# Search images in the directories without README
+%[1]s -r SOME_DIR --parent --parent-marker 'README*' -e 'ext == ".png" && !parent.markers["README*"]'
+# Search files with more than 500 siblings
+%[1]s -r SOME_DIR --parent -e 'parent.entry_count > 500'
+# Apply .mf.yaml in the directories
+%[1]s -r SOME_DIR --local-config -e 'minutes > 3'
+# Walk overlapping roots without duplicates
+%[1]s -r 'SOME_DIR;SOME_DIR/SUB_DIR' --dedup path
 # Envvars
 ROOT=SOME_DIR EXPR='size==0' %[1]s
 # Format by expr
 %[1]s -r SOME_DIR -f '{n:name,s:size}'
 # Search name by regexp in zip
 %[1]s -z SOME.zip -e 'name matches "green"'
+# Search name by regexp in tar.gz
+%[1]s -t SOME.tar.gz -e 'name matches "green"'
+# Search name by regexp in directory and zip files under it
+%[1]s -r SOME_DIR -a 'ext == ".zip"' -e 'name matches "green"'
+# Search large logs in rotated logs
+%[1]s -r SOME_DIR --decompress -e 'compression == "gzip" && size > 1000000'
+# Search the cached packages shipping the file
+%[1]s -r /var/cache/apt/archives -a 'ext == ".deb"' --deb -e 'deb_file == "/usr/bin/foo"' -f '{pkg:deb_package,ver:deb_version}'
+# Search the secrets left in the layers of the image, even deleted by the later layers
+%[1]s -r image://SOME_IMAGE.tar -e 'name endsWith ".pem"' -f '{path:path,layer:layer_digest,deleted:layer_shadowed}'
+# Search large files in the final file system of the image
+%[1]s -r image://SOME_OCI_DIR -e '!layer_shadowed && size > 100000000'
+# Search name by regexp in iso
+%[1]s -r iso://SOME.iso -e 'name matches "green"'
+# Search files containing the word at the revision
+%[1]s -r git://SOME_REPO@v1.0 --probe 'grep -q TODO && echo todo=yes || echo todo=no' -e 'p0.todo == "yes"'
+# Search name by regexp in jars in zip
+%[1]s -z SOME.zip --nest-depth 1 -e 'archive_parent endsWith ".jar" && name matches "green"'
 Flags:
 
 `
@@ -1,7 +1,10 @@
 package main_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +13,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -95,6 +99,17 @@ EOS`)
 				f4,
 			},
 		},
+		{
+			title: "access",
+			args: []string{
+				"-r", d,
+				"-e", `readable && !executable && name matches '^green'`,
+			},
+			want: []string{
+				f1,
+				f3,
+			},
+		},
 		{
 			title: "equal pairs probe",
 			args: []string{
@@ -151,6 +166,30 @@ EOS`)
 				f2,
 			},
 		},
+		{
+			title: "nul separated paths from stdin",
+			stdin: bytes.NewBufferString(f1 + "\x00" + f2 + "\x00"),
+			args: []string{
+				"-r", "-",
+				"-0",
+			},
+			want: []string{
+				f1,
+				f2,
+			},
+		},
+		{
+			title: "json from stdin",
+			stdin: bytes.NewBufferString(fmt.Sprintf("{\"path\":%q,\"tag\":\"x\"}\n{\"path\":%q,\"tag\":\"y\"}\n", f1, f2)),
+			args: []string{
+				"-r", "-",
+				"--stdin-json",
+				"-e", `tag == "y"`,
+			},
+			want: []string{
+				f2,
+			},
+		},
 		{
 			title: "all paths from stdin",
 			stdin: bytes.NewBufferString(d),
@@ -239,6 +278,396 @@ EOS`)
 		eqWant(t, []string{f3}, ss)
 	})
 
+	t.Run("index scheme", func(t *testing.T) {
+		index, err := run(nil, nil, e.cmd, "-r", d, "-v")
+		assert.Nil(t, err)
+		indexFile := filepath.Join(t.TempDir(), "index.jsonl")
+		if err := os.WriteFile(indexFile, index, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := run(nil, nil, e.cmd, "-r", fmt.Sprintf("%s;index://%s", d, indexFile), "-f", "source", "-e", `name == "green2"`)
+		assert.Nil(t, err)
+		ss := strings.Split(string(got), "\n")
+		eqWant(t, []string{
+			fmt.Sprintf("%q", d),
+			fmt.Sprintf("%q", "index://"+indexFile),
+		}, ss)
+	})
+
+	t.Run("dedup", func(t *testing.T) {
+		got, err := run(nil, nil, e.cmd, "-r", fmt.Sprintf("%s;file://%s", d, d), "--dedup", "path", "-f", "root", "-e", `name == "green"`)
+		assert.Nil(t, err)
+		ss := strings.Split(string(got), "\n")
+		eqWant(t, []string{fmt.Sprintf("%q", d)}, ss)
+	})
+
+	t.Run("setup failure", func(t *testing.T) {
+		// more files than the buffers
+		dir := t.TempDir()
+		for i := range 1000 {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprint(i)), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		got, _ := exec.CommandContext(ctx, e.cmd, "-r", dir, "-p", "@"+filepath.Join(dir, "nonexistent")).Output()
+		assert.Nil(t, ctx.Err(), "should not hang")
+		assert.Empty(t, got)
+	})
+
+	t.Run("root and zroot", func(t *testing.T) {
+		z := filepath.Join(t.TempDir(), "green.zip")
+		f, err := os.Create(z)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		w, err := zw.Create("green3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, "GREEN3")
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		got, err := run(nil, nil, e.cmd, "-r", d, "-z", z, "-e", `name startsWith "green"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{f1, f3, filepath.Join(z, "green3")}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("xattr", func(t *testing.T) {
+		x := newFile("xattr", "")
+		if _, err := run(nil, nil, e.cmd, "-r", x, "--xattr-set", "user.name", "--xattr-value", "upper(name)"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := run(nil, nil, e.cmd, "-r", x, "--xattr", "-f", `xattr["user.name"]`)
+		assert.Nil(t, err)
+		if string(got) == "null\n" {
+			t.Skip("xattr is not supported")
+		}
+		assert.Equal(t, `"XATTR"`+"\n", string(got))
+	})
+
+	t.Run("error out", func(t *testing.T) {
+		var (
+			notExist = join("notexist")
+			errOut   = filepath.Join(t.TempDir(), "errors.jsonl")
+		)
+		got, err := run(nil, nil, e.cmd, "-r", fmt.Sprintf("%s;%s", notExist, d), "--error-out", errOut, "-e", `name == "green"`)
+		assert.Nil(t, err)
+		ss := strings.Split(string(got), "\n")
+		eqWant(t, []string{f1}, ss)
+		b, err := os.ReadFile(errOut)
+		assert.Nil(t, err)
+		var record map[string]any
+		assert.Nil(t, json.Unmarshal(b, &record))
+		assert.Equal(t, notExist, record["root"])
+		assert.Equal(t, float64(2), record["errno"])
+	})
+
+	t.Run("config presets", func(t *testing.T) {
+		c := newFile("config-presets", `presets:
+  colors:
+    - green*
+    - red`)
+		got, err := run(nil, nil, e.cmd, "-c", c, "-r", d, "--exclude-preset", "colors,os-junk", "-e", `!(name startsWith "config")`)
+		assert.Nil(t, err)
+		ss := strings.Split(string(got), "\n")
+		eqWant(t, []string{f4, s1, join("xattr")}, ss)
+	})
+
+	t.Run("dirs", func(t *testing.T) {
+		dd := t.TempDir()
+		for _, x := range []string{"empty", filepath.Join("full", "sub")} {
+			if err := os.MkdirAll(filepath.Join(dd, x), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dd, "full", "sub", "f"), []byte("FFFF"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", dd, "--dirs", "-e", `is_dir && entry_count == 0`)
+		assert.Nil(t, err)
+		eqWant(t, []string{filepath.Join(dd, "empty")}, strings.Split(string(got), "\n"))
+
+		got, err = run(nil, nil, e.cmd, "-r", dd, "--dirs", "-e", `is_dir && total_size == 4 && name != "sub"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{dd, filepath.Join(dd, "full")}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("parent", func(t *testing.T) {
+		pd := t.TempDir()
+		for _, x := range []string{"with", "without"} {
+			if err := os.MkdirAll(filepath.Join(pd, x), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, x := range []string{
+			filepath.Join("with", "README.md"),
+			filepath.Join("with", "x.png"),
+			filepath.Join("without", "y.png"),
+			filepath.Join("without", "z.png"),
+		} {
+			if err := os.WriteFile(filepath.Join(pd, x), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", pd, "--parent", "--parent-marker", "README*;LICENSE",
+			"-e", `ext == ".png" && !parent.markers["README*"] && parent.entry_count == 2`)
+		assert.Nil(t, err)
+		eqWant(t, []string{
+			filepath.Join(pd, "without", "y.png"),
+			filepath.Join(pd, "without", "z.png"),
+		}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("decompress", func(t *testing.T) {
+		gd := t.TempDir()
+		for name, content := range map[string]string{
+			"app.log.1": strings.Repeat("x", 1000),
+			"app.log.2": "short",
+		} {
+			p := filepath.Join(gd, name)
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := exec.Command("gzip", p).Run(); err != nil {
+				t.Skipf("gzip: %v", err)
+			}
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", gd, "--decompress", "-e", `size > 100`)
+		assert.Nil(t, err)
+		eqWant(t, []string{filepath.Join(gd, "app.log.1.gz", "app.log.1")}, strings.Split(string(got), "\n"))
+
+		got, err = run(nil, nil, e.cmd, "-r", gd, "--decompress",
+			"-p", `echo "head=$(head -c 5)"`, "-e", `p0.head == "short"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{filepath.Join(gd, "app.log.2.gz", "app.log.2")}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("deb", func(t *testing.T) {
+		var (
+			dd   = t.TempDir()
+			pkg  = filepath.Join(dd, "pkg")
+			deb  = filepath.Join(dd, "cache", "foo_1.0_all.deb")
+			file = func(content string, s ...string) {
+				p := filepath.Join(append([]string{pkg}, s...)...)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		file("2.0\n", "debian-binary")
+		file("Package: foo\nVersion: 1.0\nArchitecture: all\n", "control", "control")
+		file("FOO", "data", "usr", "bin", "foo")
+		file("BAR", "data", "usr", "bin", "bar")
+		if err := os.MkdirAll(filepath.Dir(deb), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{
+			{"tar", "-czf", filepath.Join(pkg, "control.tar.gz"), "-C", filepath.Join(pkg, "control"), "./control"},
+			{"tar", "-czf", filepath.Join(pkg, "data.tar.gz"), "-C", filepath.Join(pkg, "data"), "./usr"},
+			{"ar", "rc", deb, filepath.Join(pkg, "debian-binary"), filepath.Join(pkg, "control.tar.gz"), filepath.Join(pkg, "data.tar.gz")},
+		} {
+			if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+				t.Skipf("%s: %v", args[0], err)
+			}
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", filepath.Dir(deb), "-a", `ext == ".deb"`, "--deb",
+			"-e", `deb_file == "/usr/bin/foo"`, "-f", `deb_package + "=" + deb_version`)
+		assert.Nil(t, err)
+		eqWant(t, []string{`"foo=1.0"`}, strings.Split(string(got), "\n"))
+
+		got, err = run(nil, nil, e.cmd, "-r", "ar://"+deb, "-f", `relpath`)
+		assert.Nil(t, err)
+		eqWant(t, []string{`"debian-binary"`, `"control.tar.gz"`, `"data.tar.gz"`}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("image", func(t *testing.T) {
+		var (
+			id   = t.TempDir()
+			src  = filepath.Join(id, "src")
+			img  = filepath.Join(id, "image.tar")
+			file = func(content string, s ...string) {
+				p := filepath.Join(append([]string{src}, s...)...)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		// the secret is deleted by the 2nd layer
+		file("KEY", "l0", "root", "secret.pem")
+		file("APP", "l0", "root", "app")
+		file("", "l1", "root", ".wh.secret.pem")
+		file(`[{"Config":"config.json","RepoTags":["example:1"],"Layers":["l0/layer.tar","l1/layer.tar"]}]`, "manifest.json")
+		for _, args := range [][]string{
+			{"tar", "-cf", filepath.Join(src, "l0", "layer.tar"), "-C", filepath.Join(src, "l0", "root"), "."},
+			{"tar", "-cf", filepath.Join(src, "l1", "layer.tar"), "-C", filepath.Join(src, "l1", "root"), "."},
+			{"tar", "-cf", img, "-C", src, "manifest.json", "l0/layer.tar", "l1/layer.tar"},
+		} {
+			if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+				t.Skipf("%s: %v", args[0], err)
+			}
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", "image://"+img, "-e", `ext == ".pem"`, "-f", `[relpath, layer_index, layer_shadowed]`)
+		assert.Nil(t, err)
+		eqWant(t, []string{`["secret.pem",0,true]`}, strings.Split(string(got), "\n"))
+
+		got, err = run(nil, nil, e.cmd, "-r", "image://"+img, "-e", `!layer_shadowed`, "-f", `image + ":" + relpath`)
+		assert.Nil(t, err)
+		eqWant(t, []string{`"example:1:app"`}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("iso", func(t *testing.T) {
+		var (
+			id  = t.TempDir()
+			src = filepath.Join(id, "src")
+			iso = filepath.Join(id, "image.iso")
+		)
+		if err := os.MkdirAll(filepath.Join(src, "docs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{
+			"docs/Green.txt": "GREEN",
+			"red.txt":        "RED",
+		} {
+			if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := exec.Command("bsdtar", "-cf", iso, "--format", "iso9660", "-C", src, ".").Run(); err != nil {
+			t.Skipf("bsdtar: %v", err)
+		}
+
+		got, err := run(nil, nil, e.cmd, "-r", "iso://"+iso, "-e", `name matches "Green"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{filepath.Join(iso, "docs", "Green.txt")}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("git", func(t *testing.T) {
+		var (
+			repo = t.TempDir()
+			git  = func(arg ...string) {
+				cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=mf", "-c", "user.email=mf@example.com"}, arg...)...)
+				if err := cmd.Run(); err != nil {
+					t.Fatalf("git %v: %v", arg, err)
+				}
+			}
+			file = func(name, content string) {
+				if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skipf("git: %v", err)
+		}
+		git("init", "-q")
+		file("green.txt", "TODO: green")
+		file("red.txt", "red")
+		git("add", ".")
+		git("commit", "-q", "-m", "first")
+		file("green.txt", "green")
+		git("commit", "-q", "-am", "second")
+
+		got, err := run(nil, nil, e.cmd, "-r", "git://"+repo+"@HEAD~1",
+			"-p", `grep -q TODO && echo todo=yes || echo todo=no`, "-e", `p0.todo == "yes"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{filepath.Join(repo+"@HEAD~1", "green.txt")}, strings.Split(string(got), "\n"))
+
+		got, err = run(nil, nil, e.cmd, "-r", "git://"+repo,
+			"-p", `grep -q TODO && echo todo=yes || echo todo=no`, "-e", `p0.todo == "yes"`)
+		assert.Nil(t, err)
+		eqWant(t, []string{}, strings.Split(string(got), "\n"))
+	})
+
+	t.Run("local config", func(t *testing.T) {
+		var (
+			ld      = t.TempDir()
+			newFile = func(content string, s ...string) string {
+				p := filepath.Join(append([]string{ld}, s...)...)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			c = newFile(`fields:
+  kind: '"global"'
+  size2: size * 2`, "config.yaml")
+			a1 = newFile("A1", "a", "a1")
+			b1 = newFile("B1", "a", "b", "b1")
+			l1 = newFile(`exclude: ext == ".tmp"
+probe:
+  - echo "v=outer"
+fields:
+  kind: '"a"'`, "a", ".mf.yaml")
+			l2 = newFile(`exclude: ext == ".log"
+probe:
+  - echo "v=inner"
+pname:
+  - q
+fields:
+  kind: l0.v + "+" + q.v`, "a", "b", ".mf.yaml")
+		)
+		newFile("A2", "a", "a2.tmp")
+		newFile("B2", "a", "b", "b2.log")
+
+		got, err := run(nil, nil, e.cmd, "-c", c, "-r", ld, "--local-config",
+			"-x", `name == "config.yaml" || name == ".mf.yaml"`,
+			"-f", `{path:path,kind:kind,size2:size2,local:local_config}`)
+		assert.Nil(t, err)
+
+		type result struct {
+			Path  string   `json:"path"`
+			Kind  string   `json:"kind"`
+			Size2 int      `json:"size2"`
+			Local []string `json:"local"`
+		}
+		var results []result
+		for _, line := range strings.Split(strings.TrimSpace(string(got)), "\n") {
+			var r result
+			assert.Nil(t, json.Unmarshal([]byte(line), &r))
+			results = append(results, r)
+		}
+		slices.SortFunc(results, func(a, b result) int { return strings.Compare(a.Path, b.Path) })
+		assert.Equal(t, []result{
+			{Path: a1, Kind: "a", Size2: 4, Local: []string{l1}},
+			{Path: b1, Kind: "outer+inner", Size2: 4, Local: []string{l1, l2}},
+		}, results)
+
+		t.Run("rejected from stdin", func(t *testing.T) {
+			stdin := bytes.NewBufferString(fmt.Sprintf(`{"path":%q,"local_config":[%q]}`, c, l1))
+			got, err := run(stdin, nil, e.cmd, "-r", "-", "--stdin-json", "--local-config", "-f", "l0")
+			assert.Nil(t, err)
+			assert.Equal(t, "", string(got))
+		})
+
+		t.Run("not from index", func(t *testing.T) {
+			index := filepath.Join(t.TempDir(), "index.json")
+			assert.Nil(t, os.WriteFile(index, []byte(fmt.Sprintf(`{"path":%q,"local_config":[%q]}`, c, l1)), 0o600))
+			got, err := run(nil, nil, e.cmd, "-i", index, "--local-config", "-f", "l0")
+			assert.Nil(t, err)
+			assert.Equal(t, "null\n", string(got))
+		})
+	})
+
 	t.Run("config", func(t *testing.T) {
 		c := newFile("config", fmt.Sprintf(`root:
   - "%s"
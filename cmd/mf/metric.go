@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/iox"
 	"github.com/berquerant/metafind/meta"
 	"github.com/berquerant/metafind/metric"
 	"github.com/berquerant/metafind/walk"
@@ -17,6 +18,13 @@ func NewMetrics(duration time.Duration) any {
 		walk.WalkEntryCount,
 		walk.WalkExcludeCount,
 		walk.WalkExcludeErrCount,
+		walk.WalkArchiveCount,
+		walk.WalkErrCount,
+		walk.WalkIgnoreCount,
+		walk.WalkPruneCount,
+		walk.WalkLocalConfigCount,
+		walk.WalkCompressedCount,
+		iox.WalkDedupCount,
 		expr.RawRunCount,
 		expr.RawErrCount,
 		expr.RunCount,
@@ -28,6 +36,10 @@ func NewMetrics(duration time.Duration) any {
 		meta.ProbeSuccessCount,
 		meta.ProbeFailureCount,
 		AcceptCount,
+		XattrSetCount,
+		XattrSetErrCount,
+		FieldCount,
+		FieldErrCount,
 	}
 
 	d := map[string]any{
@@ -46,6 +46,19 @@ func (p *Program) Run(env map[string]any) (bool, error) {
 	return false, nil
 }
 
+// Identifiers returns the names of the variables in e.
+// ok is false if e cannot tell them.
+func Identifiers(e any) (names []string, ok bool) {
+	switch e := e.(type) {
+	case *Program:
+		return Identifiers(e.raw)
+	case *RawProgram:
+		return e.Identifiers(), true
+	default:
+		return nil, false
+	}
+}
+
 func AsBool(v any) bool {
 	if v == nil {
 		return false
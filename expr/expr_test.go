@@ -113,3 +113,29 @@ func TestAsBool(t *testing.T) {
 		}
 	})
 }
+
+func TestIdentifiers(t *testing.T) {
+	for _, tc := range []struct {
+		code string
+		want []string
+	}{
+		{
+			code: `1`,
+			want: []string{},
+		},
+		{
+			code: `name == "x" || size > 10`,
+			want: []string{"name", "size"},
+		},
+		{
+			code: `p0.p matches "x" && len(path) > 1 && p0.q`,
+			want: []string{"p0", "path"},
+		},
+	} {
+		t.Run(tc.code, func(t *testing.T) {
+			got, ok := expr.Identifiers(expr.New(expr.MustNewRaw(tc.code)))
+			assert.True(t, ok)
+			assert.ElementsMatch(t, tc.want, got)
+		})
+	}
+}
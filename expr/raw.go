@@ -3,10 +3,12 @@ package expr
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/berquerant/metafind/logx"
 	"github.com/berquerant/metafind/metric"
 	exprl "github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/vm"
 )
 
@@ -62,3 +64,22 @@ func (p *RawProgram) Run(env map[string]any) (any, error) {
 
 	return v, nil
 }
+
+// Identifiers returns the names of the variables in the program.
+func (p *RawProgram) Identifiers() []string {
+	v := &identifierVisitor{}
+	node := p.program.Node()
+	ast.Walk(&node, v)
+	slices.Sort(v.names)
+	return slices.Compact(v.names)
+}
+
+type identifierVisitor struct {
+	names []string
+}
+
+func (v *identifierVisitor) Visit(node *ast.Node) {
+	if x, ok := (*node).(*ast.IdentifierNode); ok {
+		v.names = append(v.names, x.Value)
+	}
+}
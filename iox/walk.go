@@ -2,53 +2,112 @@ package iox
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"sync"
 
-	"github.com/berquerant/metafind/syncx"
+	"github.com/berquerant/metafind/metric"
 	"github.com/berquerant/metafind/walk"
 )
 
 const walkerBufferSize = 100
 
+// RootError is an error occurred while walking the root.
+type RootError struct {
+	Root string
+	Err  error
+}
+
+func (e *RootError) Error() string { return fmt.Sprintf("%v: root %s", e.Err, e.Root) }
+func (e *RootError) Unwrap() error { return e.Err }
+
+type WalkerOption func(*Walker)
+
+// WithDedup makes Walker yield the same file reached from the different roots only once.
+func WithDedup(dedup walk.Dedup) WalkerOption {
+	return func(w *Walker) {
+		w.dedup = dedup
+	}
+}
+
 type Walker struct {
 	roots  []string
 	walker walk.Walker
-	err    error
+	dedup  walk.Dedup
 }
 
-func NewWalker(walker walk.Walker, root ...string) *Walker {
-	return &Walker{
+func NewWalker(walker walk.Walker, roots []string, opt ...WalkerOption) *Walker {
+	w := &Walker{
 		walker: walker,
-		roots:  root,
+		roots:  roots,
 	}
+	for _, f := range opt {
+		f(w)
+	}
+	return w
 }
 
-func (w *Walker) Err() error { return w.err }
-
-func (w *Walker) Start(ctx context.Context) <-chan walk.Entry {
-	entryC := make(chan walk.Entry, walkerBufferSize)
+var (
+	WalkDedupCount = metric.NewCounter("WalkDedup")
+)
 
-	go func() {
-		defer close(entryC)
+// Start walks the roots concurrently.
+// The errors are wrapped by RootError and sent to the error channel,
+// which should be drained concurrently with the entry channel.
+// Both channels are closed when the walk ends or ctx is done.
+//
+// If dedup is enabled, the entry of the file yielded first wins,
+// so the root of the entry is not deterministic when the roots overlap.
+func (w *Walker) Start(ctx context.Context) (<-chan walk.Entry, <-chan error) {
+	var (
+		entryC = make(chan walk.Entry, walkerBufferSize)
+		errC   = make(chan error, walkerBufferSize)
+		wg     sync.WaitGroup
+		mux    sync.Mutex
+		seen   = map[string]bool{}
+	)
+	isDup := func(e walk.Entry) bool {
+		key, ok := w.dedup.Key(e)
+		if !ok {
+			return false
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		if seen[key] {
+			WalkDedupCount.Incr()
+			return true
+		}
+		seen[key] = true
+		return false
+	}
 
-		var errs []error
-		for _, root := range w.roots {
-			if syncx.Done(ctx) {
-				break
-			}
-			for e := range w.walker.Walk(root) {
-				if syncx.Done(ctx) {
-					break
+	for _, root := range w.roots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e, err := range w.walker.Walk(ctx, root) {
+				if err != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case errC <- &RootError{Root: root, Err: err}:
+					}
+					continue
+				}
+				if isDup(e) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case entryC <- e:
 				}
-				entryC <- e
-			}
-			if err := w.walker.Err(); err != nil {
-				errs = append(errs, err)
 			}
-		}
-
-		w.err = errors.Join(errs...)
+		}()
+	}
+	go func() {
+		defer close(errC)
+		defer close(entryC)
+		wg.Wait()
 	}()
-
-	return entryC
+	return entryC, errC
 }
@@ -0,0 +1,121 @@
+package iox_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/berquerant/metafind/iox"
+	"github.com/berquerant/metafind/walk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalker(t *testing.T) {
+	d := t.TempDir()
+	for _, x := range []string{"f1", "f2", "f3"} {
+		if err := os.WriteFile(filepath.Join(d, x), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notExist := filepath.Join(d, "notexist")
+
+	t.Run("walk", func(t *testing.T) {
+		w := iox.NewWalker(walk.NewFile(nil), []string{d, notExist, d})
+		entryC, errC := w.Start(context.TODO())
+		var errs []error
+		errDone := make(chan struct{})
+		go func() {
+			defer close(errDone)
+			for err := range errC {
+				errs = append(errs, err)
+			}
+		}()
+		var n int
+		for range entryC {
+			n++
+		}
+		<-errDone
+		assert.Equal(t, 6, n)
+		if assert.Len(t, errs, 1) {
+			assert.ErrorIs(t, errs[0], os.ErrNotExist)
+			assert.ErrorContains(t, errs[0], "root "+notExist)
+		}
+	})
+
+	t.Run("dedup", func(t *testing.T) {
+		var (
+			sub  = filepath.Join(d, "sub")
+			link = filepath.Join(t.TempDir(), "link")
+		)
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(sub)
+		if err := os.WriteFile(filepath.Join(sub, "f4"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(filepath.Join(d, "f1"), filepath.Join(sub, "f5")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(d, link); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			title string
+			dedup walk.Dedup
+			roots []string
+			want  int
+		}{
+			{
+				title: "none",
+				roots: []string{d, sub},
+				want:  7,
+			},
+			{
+				title: "path overlap",
+				dedup: walk.DedupPath,
+				roots: []string{d, sub},
+				want:  5,
+			},
+			{
+				title: "path symlink",
+				dedup: walk.DedupPath,
+				roots: []string{d, link + "/"},
+				want:  5,
+			},
+			{
+				title: "inode",
+				dedup: walk.DedupInode,
+				roots: []string{d, sub},
+				want:  4,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				w := iox.NewWalker(walk.NewFile(nil), tc.roots, iox.WithDedup(tc.dedup))
+				entryC, errC := w.Start(context.TODO())
+				var paths []string
+				for e := range entryC {
+					paths = append(paths, e.Path())
+				}
+				for err := range errC {
+					t.Error(err)
+				}
+				assert.Len(t, paths, tc.want, "%v", paths)
+			})
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		w := iox.NewWalker(walk.NewFile(nil), []string{d, d, d})
+		entryC, errC := w.Start(ctx)
+		<-entryC
+		cancel()
+		for range entryC {
+		}
+		for range errC {
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 
 type Data struct {
 	d map[string]any
+	// origin is the value the data is made from, not marshaled
+	origin any
 }
 
 func NewData(d map[string]any) *Data {
@@ -24,6 +26,12 @@ func (d Data) Get(key string) (any, bool) {
 	return v, ok
 }
 
+// Origin returns the value the data is made from, e.g. the entry of the walk; nil if unknown.
+func (d Data) Origin() any { return d.origin }
+
+// SetOrigin sets the value the data is made from.
+func (d *Data) SetOrigin(v any) { d.origin = v }
+
 func (d *Data) Merge(x *Data) {
 	if x == nil {
 		return
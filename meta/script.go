@@ -18,7 +18,15 @@ type Prober interface {
 	Probe(ctx context.Context, path string) (*Data, error)
 }
 
-var _ Prober = &Script{}
+// StreamProber probes the content read from r instead of the file of path.
+type StreamProber interface {
+	ProbeStream(ctx context.Context, path string, r io.Reader) (*Data, error)
+}
+
+var (
+	_ Prober       = &Script{}
+	_ StreamProber = &Script{}
+)
 
 type Script struct {
 	s *execx.Script
@@ -66,11 +74,23 @@ var (
 )
 
 func (s *Script) Probe(ctx context.Context, path string) (*Data, error) {
+	return s.probe(ctx, path, nil)
+}
+
+// ProbeStream is Probe but the script reads the content from stdin.
+func (s *Script) ProbeStream(ctx context.Context, path string, r io.Reader) (*Data, error) {
+	return s.probe(ctx, path, r)
+}
+
+func (s *Script) probe(ctx context.Context, path string, stdin io.Reader) (*Data, error) {
 	ProbeCount.Incr()
 	var data *Data
 
 	if err := s.s.Runner(func(cmd *execx.Cmd) error {
 		cmd.Args = append(cmd.Args, path)
+		if stdin != nil {
+			cmd.Stdin = stdin
+		}
 		r, err := cmd.Run(ctx, execx.WithCaptureStdout(true))
 		if err != nil {
 			return fmt.Errorf("%w: cmd.run: args=%s", err, logx.Jsonify(cmd.Args))
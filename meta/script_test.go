@@ -3,6 +3,7 @@ package meta_test
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/berquerant/metafind/meta"
@@ -122,3 +123,17 @@ EOS`, tc.raw)
 		})
 	}
 }
+
+func TestScriptProbeStream(t *testing.T) {
+	s := meta.NewScript(`echo "arg=$1"
+echo "stdin=$(cat)"`, "sh")
+	defer s.Close()
+	got, err := s.ProbeStream(context.TODO(), "DUMMY", strings.NewReader("CONTENT"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"arg":   "DUMMY",
+		"stdin": "CONTENT",
+	}, got.Unwrap())
+}
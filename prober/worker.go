@@ -13,9 +13,11 @@ type Data = meta.Data
 type Worker = worker.Worker[*Data, *Data]
 
 // AddData add metadata obtained from Prober.
+// Prober reads the decompressed content of the file in the compressed file,
+// or the content of the file in the git repository if it is meta.StreamProber.
 func AddData(ctx context.Context, name string, p Prober, x *Data) (*Data, error) {
 	path := walk.GetPathFromMetadata(x)
-	y, err := p.Probe(ctx, path)
+	y, err := probe(ctx, p, path, x)
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +25,22 @@ func AddData(ctx context.Context, name string, p Prober, x *Data) (*Data, error)
 	return x, nil
 }
 
+func probe(ctx context.Context, p Prober, path string, x *Data) (*Data, error) {
+	sp, ok := p.(meta.StreamProber)
+	if !ok {
+		return p.Probe(ctx, path)
+	}
+	r, ok, err := walk.OpenContent(ctx, x)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return p.Probe(ctx, path)
+	}
+	defer r.Close()
+	return sp.ProbeStream(ctx, path, r)
+}
+
 func NewWorker(p Prober, n int, name string) *Worker {
 	f := func(ctx context.Context, x *Data) (*Data, error) {
 		return AddData(ctx, name, p, x)
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package walk
+
+import "github.com/berquerant/metafind/meta"
+
+// newAccessMetadata is not available on this platform.
+func newAccessMetadata(_ Entry) *meta.Data { return nil }
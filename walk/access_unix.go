@@ -0,0 +1,21 @@
+//go:build unix
+
+package walk
+
+import (
+	"github.com/berquerant/metafind/meta"
+	"golang.org/x/sys/unix"
+)
+
+// newAccessMetadata returns the permissions of the current user for the entry on the file system by access(2).
+func newAccessMetadata(entry Entry) *meta.Data {
+	if entry.Info() == nil || len(entry.Chain()) > 0 {
+		return nil
+	}
+	path := entry.Path()
+	return meta.NewData(map[string]any{
+		"readable":   unix.Access(path, unix.R_OK) == nil,
+		"writable":   unix.Access(path, unix.W_OK) == nil,
+		"executable": unix.Access(path, unix.X_OK) == nil,
+	})
+}
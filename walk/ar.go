@@ -0,0 +1,282 @@
+package walk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berquerant/metafind/expr"
+)
+
+var _ Walker = &ArWalker{}
+
+func NewAr(exclude expr.Expr, opt ...ArchiveOption) *ArWalker {
+	return &ArWalker{
+		archiveWalker: newArchiveWalker(exclude, opt...),
+	}
+}
+
+// ArWalker walks files in ar, or the files in data.tar of deb with WithDeb.
+type ArWalker struct {
+	archiveWalker
+}
+
+func (w *ArWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		return w.walkArchive(ctx, archiveAr, root, send)
+	})
+}
+
+var arMagic = []byte("!<arch>\n")
+
+const arHeaderSize = 60
+
+// arHeader is the header of the file in ar.
+type arHeader struct {
+	Name    string
+	ModTime time.Time
+	Uid     int
+	Gid     int
+	Mode    int64
+	Size    int64
+}
+
+func (h *arHeader) FileInfo() fs.FileInfo { return &arFileInfo{h: h} }
+
+var _ fs.FileInfo = &arFileInfo{}
+
+type arFileInfo struct {
+	h *arHeader
+}
+
+func (i *arFileInfo) Name() string       { return path.Base(i.h.Name) }
+func (i *arFileInfo) Size() int64        { return i.h.Size }
+func (i *arFileInfo) Mode() fs.FileMode  { return fs.FileMode(i.h.Mode).Perm() }
+func (i *arFileInfo) ModTime() time.Time { return i.h.ModTime }
+func (i *arFileInfo) IsDir() bool        { return false }
+func (i *arFileInfo) Sys() any           { return i.h }
+
+// arReader reads the files in ar sequentially, like tar.Reader.
+// The GNU and the BSD long names are supported, and the symbol tables are skipped.
+type arReader struct {
+	r         io.Reader
+	cur       io.Reader
+	pad       int64
+	longNames []byte
+}
+
+func newArReader(r io.Reader) (*arReader, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("%w: ar: %w", ErrArchive, err)
+	}
+	if !bytes.Equal(magic, arMagic) {
+		return nil, fmt.Errorf("%w: ar: bad magic", ErrArchive)
+	}
+	return &arReader{
+		r:   r,
+		cur: bytes.NewReader(nil),
+	}, nil
+}
+
+// Read reads the content of the current file.
+func (r *arReader) Read(p []byte) (int, error) { return r.cur.Read(p) }
+
+// Next advances to the next file.
+// Returns io.EOF at the end of ar.
+func (r *arReader) Next() (*arHeader, error) {
+	for {
+		// the data are aligned to even
+		if _, err := io.Copy(io.Discard, r.cur); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, r.r, r.pad); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		var b [arHeaderSize]byte
+		if _, err := io.ReadFull(r.r, b[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("%w: ar: %w", ErrArchive, err)
+		}
+		h, err := parseArHeader(b[:])
+		if err != nil {
+			return nil, err
+		}
+		r.cur = io.LimitReader(r.r, h.Size)
+		r.pad = h.Size % 2
+
+		switch {
+		case h.Name == "/" || h.Name == "/SYM64/" || strings.HasPrefix(h.Name, "__.SYMDEF"):
+			// symbol table
+			continue
+		case h.Name == "//":
+			// GNU long names table
+			if r.longNames, err = io.ReadAll(r.cur); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(h.Name, "#1/"):
+			// BSD long name precedes the data
+			n, err := strconv.ParseInt(h.Name[3:], 10, 64)
+			if err != nil || n < 0 || n > h.Size {
+				return nil, fmt.Errorf("%w: ar: bad name: %s", ErrArchive, h.Name)
+			}
+			name := make([]byte, n)
+			if _, err := io.ReadFull(r.cur, name); err != nil {
+				return nil, fmt.Errorf("%w: ar: %w", ErrArchive, err)
+			}
+			h.Name = string(bytes.TrimRight(name, "\x00"))
+			h.Size -= n
+		case len(h.Name) > 1 && h.Name[0] == '/':
+			// GNU long name
+			offset, err := strconv.Atoi(h.Name[1:])
+			if err != nil || offset < 0 || offset >= len(r.longNames) {
+				return nil, fmt.Errorf("%w: ar: bad name: %s", ErrArchive, h.Name)
+			}
+			name := r.longNames[offset:]
+			if i := bytes.IndexByte(name, '\n'); i >= 0 {
+				name = name[:i]
+			}
+			h.Name = strings.TrimSuffix(string(name), "/")
+		default:
+			h.Name = strings.TrimSuffix(h.Name, "/")
+		}
+		return h, nil
+	}
+}
+
+func parseArHeader(b []byte) (*arHeader, error) {
+	if string(b[58:60]) != "`\n" {
+		return nil, fmt.Errorf("%w: ar: bad header", ErrArchive)
+	}
+	field := func(from, to int) string {
+		return strings.TrimSpace(string(b[from:to]))
+	}
+	number := func(from, to, base int) (int64, error) {
+		x := field(from, to)
+		if x == "" {
+			return 0, nil
+		}
+		return strconv.ParseInt(x, base, 64)
+	}
+	var (
+		h   = &arHeader{Name: field(0, 16)}
+		err error
+		x   [5]int64
+	)
+	for i, f := range []struct{ from, to, base int }{
+		{16, 28, 10}, // mtime
+		{28, 34, 10}, // uid
+		{34, 40, 10}, // gid
+		{40, 48, 8},  // mode
+		{48, 58, 10}, // size
+	} {
+		if x[i], err = number(f.from, f.to, f.base); err != nil {
+			return nil, fmt.Errorf("%w: ar: bad header: %w", ErrArchive, err)
+		}
+	}
+	if x[4] < 0 {
+		return nil, fmt.Errorf("%w: ar: bad size: %d", ErrArchive, x[4])
+	}
+	h.ModTime = time.Unix(x[0], 0)
+	h.Uid = int(x[1])
+	h.Gid = int(x[2])
+	h.Mode = x[3]
+	h.Size = x[4]
+	return h, nil
+}
+
+// isDeb returns true if name is a deb package.
+func isDeb(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".deb") || strings.HasSuffix(name, ".udeb")
+}
+
+// readDebControl reads the control file in control.tar of deb.
+func readDebControl(r io.Reader) (DebEntry, error) {
+	reader, closer, err := newTarReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: deb: no control", ErrArchive)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(header.Name) != "control" {
+			continue
+		}
+		control, err := parseDebControl(reader)
+		if err != nil {
+			return nil, err
+		}
+		var depends []string
+		for _, x := range strings.Split(control["Depends"], ",") {
+			if x = strings.TrimSpace(x); x != "" {
+				depends = append(depends, x)
+			}
+		}
+		return NewDebEntry(
+			control["Package"],
+			control["Version"],
+			control["Architecture"],
+			depends,
+			control,
+		), nil
+	}
+}
+
+// parseDebControl parses the fields of the control file.
+// The continuation lines are joined to the field by newline.
+func parseDebControl(r io.Reader) (map[string]string, error) {
+	var (
+		control = map[string]string{}
+		key     string
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			// end of paragraph
+			return control, nil
+		case strings.HasPrefix(line, "#"):
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if key == "" {
+				return nil, fmt.Errorf("%w: deb: bad control: %s", ErrArchive, line)
+			}
+			control[key] += "\n" + strings.TrimSpace(line)
+		default:
+			k, v, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%w: deb: bad control: %s", ErrArchive, line)
+			}
+			key = strings.TrimSpace(k)
+			control[key] = strings.TrimSpace(v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return control, nil
+}
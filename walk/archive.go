@@ -0,0 +1,436 @@
+package walk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/syncx"
+)
+
+// ArchiveSep separates the archives of the archive chain.
+const ArchiveSep = "!/"
+
+const defaultNestSize = 64 << 20
+
+var (
+	ErrArchive = errors.New("Archive")
+)
+
+// cleanMemberName returns the name of the member of the archive cleaned to be relative to the archive.
+// ok is false if the name is the archive itself or escapes the archive, e.g. absolute or starting with "..".
+func cleanMemberName(name string) (string, bool) {
+	x := path.Clean(name)
+	if x == "." || path.IsAbs(x) || x == ".." || strings.HasPrefix(x, "../") {
+		return "", false
+	}
+	return x, true
+}
+
+type ArchiveOption func(*archiveWalker)
+
+// WithNestDepth enables the descent into the archives in the archive up to depth.
+func WithNestDepth(depth int) ArchiveOption {
+	return func(w *archiveWalker) {
+		w.nestDepth = depth
+	}
+}
+
+// WithNestSize sets the max size (in bytes) of the nested archive to be buffered in memory.
+// Larger archives are spilled to temporary files.
+func WithNestSize(size int64) ArchiveOption {
+	return func(w *archiveWalker) {
+		w.nestSize = size
+	}
+}
+
+// WithDeb makes the walkers walk the files in data.tar of the deb packages instead of the files in the packages,
+// attaching the fields of the control file.
+func WithDeb(enabled bool) ArchiveOption {
+	return func(w *archiveWalker) {
+		w.deb = enabled
+	}
+}
+
+type archiveKind int
+
+const (
+	archiveUnknown archiveKind = iota
+	archiveZip
+	archiveTar
+	archiveAr
+	archiveISO
+)
+
+func archiveKindOf(name string) archiveKind {
+	name = strings.ToLower(name)
+	for _, x := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar.xz", ".txz", ".tar.zst", ".tzst"} {
+		if strings.HasSuffix(name, x) {
+			return archiveTar
+		}
+	}
+	switch filepath.Ext(name) {
+	case ".zip", ".jar", ".war", ".ear", ".whl", ".apk":
+		return archiveZip
+	case ".ar", ".deb", ".udeb":
+		return archiveAr
+	case ".iso":
+		return archiveISO
+	default:
+		return archiveUnknown
+	}
+}
+
+type archiveReader interface {
+	io.Reader
+	io.ReaderAt
+}
+
+// archiveWalker walks the entries of the archives, descending into the nested archives.
+type archiveWalker struct {
+	FileWalker
+	nestDepth int
+	nestSize  int64
+	deb       bool
+}
+
+func newArchiveWalker(exclude expr.Expr, opt ...ArchiveOption) archiveWalker {
+	w := archiveWalker{
+		FileWalker: FileWalker{
+			exclude: exclude,
+		},
+		nestSize: defaultNestSize,
+	}
+	for _, f := range opt {
+		f(&w)
+	}
+	return w
+}
+
+// walkArchive walks the archive file root.
+func (w *archiveWalker) walkArchive(ctx context.Context, kind archiveKind, root string, send func(Entry, error) bool) error {
+	f, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch kind {
+	case archiveZip:
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return w.walkZip(ctx, f, info.Size(), root, root, []string{root}, send)
+	case archiveTar:
+		return w.walkTar(ctx, f, root, root, []string{root}, nil, send)
+	case archiveAr:
+		return w.walkAr(ctx, f, root, root, []string{root}, send)
+	case archiveISO:
+		return w.walkISO(ctx, f, root, root, []string{root}, send)
+	default:
+		return fmt.Errorf("%w: unknown archive: %s", ErrArchive, root)
+	}
+}
+
+// emit sends entry unless it is rejected or a directory.
+// Returns true if entry is sent.
+func (w *archiveWalker) emit(entry Entry, send func(Entry, error) bool) bool {
+	if w.isRejected(entry, nil) {
+		return false
+	}
+	if entry.Info().IsDir() {
+		WalkDirCount.Incr()
+		// skip dir
+		return false
+	}
+	WalkEntryCount.Incr()
+	return send(entry, nil)
+}
+
+func (w *archiveWalker) walkZip(
+	ctx context.Context,
+	r io.ReaderAt,
+	size int64,
+	root, path string,
+	chain []string,
+	send func(Entry, error) bool,
+) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		name, ok := cleanMemberName(file.Name)
+		if !ok {
+			if !file.FileInfo().IsDir() {
+				slog.Warn("ZipWalker: skip invalid name", slog.String("root", root), slog.String("name", file.Name))
+			}
+			continue
+		}
+		p := filepath.Join(path, filepath.FromSlash(name))
+		slog.Debug("ZipWalker", slog.String("root", root), slog.String("path", p))
+		WalkCallCount.Incr()
+		if syncx.Done(ctx) {
+			return nil
+		}
+		entry := NewEntry(
+			p,
+			file.FileInfo(),
+			EntryAttrs{
+				Zip: NewZipEntry(
+					root,
+					name,
+					file.CompressedSize64,
+					file.UncompressedSize64,
+					file.Comment,
+					file.NonUTF8,
+				),
+				Chain: chain,
+			},
+		)
+		if !w.emit(entry, send) {
+			continue
+		}
+		w.descend(ctx, entry, name, file.Open, root, chain, send)
+	}
+	return nil
+}
+
+// walkTar walks the files in tar.
+// deb is attached to the entries if the tar is data.tar of deb.
+func (w *archiveWalker) walkTar(
+	ctx context.Context,
+	r io.Reader,
+	root, path string,
+	chain []string,
+	deb DebEntry,
+	send func(Entry, error) bool,
+) error {
+	reader, closer, err := newTarReader(r)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := cleanMemberName(header.Name)
+		if !ok {
+			if header.Typeflag != tar.TypeDir {
+				slog.Warn("TarWalker: skip invalid name", slog.String("root", root), slog.String("name", header.Name))
+			}
+			continue
+		}
+		p := filepath.Join(path, filepath.FromSlash(name))
+		slog.Debug("TarWalker", slog.String("root", root), slog.String("path", p))
+		WalkCallCount.Incr()
+		if syncx.Done(ctx) {
+			return nil
+		}
+		entry := NewEntry(
+			p,
+			header.FileInfo(),
+			EntryAttrs{
+				Tar: NewTarEntry(
+					root,
+					name,
+					string(header.Typeflag),
+					header.Uid,
+					header.Gid,
+					header.Uname,
+					header.Gname,
+					header.Linkname,
+					header.PAXRecords,
+				),
+				Chain: chain,
+				Deb:   deb,
+			},
+		)
+		if !w.emit(entry, send) {
+			continue
+		}
+		w.descend(ctx, entry, name, func() (io.ReadCloser, error) {
+			return io.NopCloser(reader), nil
+		}, root, chain, send)
+	}
+}
+
+func (w *archiveWalker) walkAr(
+	ctx context.Context,
+	r io.Reader,
+	root, path string,
+	chain []string,
+	send func(Entry, error) bool,
+) error {
+	if w.deb && isDeb(path) {
+		return w.walkDeb(ctx, r, root, path, chain, send)
+	}
+	reader, err := newArReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := cleanMemberName(header.Name)
+		if !ok {
+			slog.Warn("ArWalker: skip invalid name", slog.String("root", root), slog.String("name", header.Name))
+			continue
+		}
+		p := filepath.Join(path, filepath.FromSlash(name))
+		slog.Debug("ArWalker", slog.String("root", root), slog.String("path", p))
+		WalkCallCount.Incr()
+		if syncx.Done(ctx) {
+			return nil
+		}
+		entry := NewEntry(
+			p,
+			header.FileInfo(),
+			EntryAttrs{
+				Chain: chain,
+				Ar: NewArEntry(
+					root,
+					name,
+					header.Uid,
+					header.Gid,
+				),
+			},
+		)
+		if !w.emit(entry, send) {
+			continue
+		}
+		w.descend(ctx, entry, name, func() (io.ReadCloser, error) {
+			return io.NopCloser(reader), nil
+		}, root, chain, send)
+	}
+}
+
+// walkDeb walks the files in data.tar of the deb package as the files in the package.
+// The control.tar precedes the data.tar in the package.
+func (w *archiveWalker) walkDeb(
+	ctx context.Context,
+	r io.Reader,
+	root, path string,
+	chain []string,
+	send func(Entry, error) bool,
+) error {
+	reader, err := newArReader(r)
+	if err != nil {
+		return err
+	}
+	var deb DebEntry
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: deb: no data.tar: %s", ErrArchive, path)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(header.Name, "control.tar"):
+			if deb, err = readDebControl(reader); err != nil {
+				return fmt.Errorf("%w: %s", err, path)
+			}
+		case strings.HasPrefix(header.Name, "data.tar"):
+			if deb == nil {
+				return fmt.Errorf("%w: deb: no control.tar before data.tar: %s", ErrArchive, path)
+			}
+			return w.walkTar(ctx, reader, root, path, chain, deb, send)
+		}
+	}
+}
+
+// descend walks entry if it is an archive and the nest depth allows.
+func (w *archiveWalker) descend(
+	ctx context.Context,
+	entry Entry,
+	relpath string,
+	open func() (io.ReadCloser, error),
+	root string,
+	chain []string,
+	send func(Entry, error) bool,
+) {
+	kind := archiveKindOf(relpath)
+	if kind == archiveUnknown || len(chain) > w.nestDepth {
+		return
+	}
+	r, closer, err := w.buffer(open, entry.Info().Size())
+	if err != nil {
+		slog.Warn("ArchiveWalker: buffer", slog.String("path", entry.Path()), logx.Err(err))
+		return
+	}
+	defer closer()
+
+	chain = append(slices.Clone(chain), relpath)
+	switch kind {
+	case archiveZip:
+		err = w.walkZip(ctx, r, entry.Info().Size(), root, entry.Path(), chain, send)
+	case archiveTar:
+		err = w.walkTar(ctx, r, root, entry.Path(), chain, nil, send)
+	case archiveAr:
+		err = w.walkAr(ctx, r, root, entry.Path(), chain, send)
+	case archiveISO:
+		err = w.walkISO(ctx, r, root, entry.Path(), chain, send)
+	}
+	if err != nil {
+		slog.Warn("ArchiveWalker: descend", slog.String("path", entry.Path()), logx.Err(err))
+	}
+}
+
+// buffer reads the nested archive into memory, or into a temporary file if it is larger than nestSize.
+func (w *archiveWalker) buffer(open func() (io.ReadCloser, error), size int64) (archiveReader, func(), error) {
+	rc, err := open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	if size <= w.nestSize {
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(b), func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "mf-nest-")
+	if err != nil {
+		return nil, nil, err
+	}
+	closer := func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		closer()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		closer()
+		return nil, nil, err
+	}
+	return f, closer, nil
+}
@@ -0,0 +1,34 @@
+// Code generated by "dataclass -type ArEntry -field Root string|RelPath string|Uid int|Gid int -output arentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type ArEntry interface {
+	Root() string
+	RelPath() string
+	Uid() int
+	Gid() int
+}
+type arEntry struct {
+	root    string
+	relPath string
+	uid     int
+	gid     int
+}
+
+func (s *arEntry) Root() string    { return s.root }
+func (s *arEntry) RelPath() string { return s.relPath }
+func (s *arEntry) Uid() int        { return s.uid }
+func (s *arEntry) Gid() int        { return s.gid }
+func NewArEntry(
+	root string,
+	relPath string,
+	uid int,
+	gid int,
+) ArEntry {
+	return &arEntry{
+		root:    root,
+		relPath: relPath,
+		uid:     uid,
+		gid:     gid,
+	}
+}
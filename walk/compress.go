@@ -0,0 +1,176 @@
+package walk
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Compression is the format of the compressed file wrapping one file.
+type Compression string
+
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// compressionOf returns the compression of the file by its name.
+// The compressed tar files are not the compressed files but the archives.
+func compressionOf(name string) Compression {
+	if archiveKindOf(name) != archiveUnknown {
+		return CompressionNone
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz":
+		return CompressionGzip
+	case ".bz2":
+		return CompressionBzip2
+	default:
+		return CompressionNone
+	}
+}
+
+// hasSize returns true if the uncompressed size is available without decompressing.
+// gzip has it in the trailer, bzip2 does not.
+func (c Compression) hasSize() bool { return c == CompressionGzip }
+
+// newDecompressor returns the reader of the decompressed content of r.
+func newDecompressor(c Compression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown compression: %s", ErrArchive, c)
+	}
+}
+
+var _ fs.FileInfo = &compressedFileInfo{}
+
+// compressedFileInfo is fs.FileInfo of the file in the compressed file.
+type compressedFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+func (i *compressedFileInfo) Name() string       { return i.name }
+func (i *compressedFileInfo) Size() int64        { return i.size }
+func (i *compressedFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *compressedFileInfo) ModTime() time.Time { return i.modTime }
+func (i *compressedFileInfo) IsDir() bool        { return false }
+func (i *compressedFileInfo) Sys() any           { return nil }
+
+// newCompressedEntry returns the entry of the file in the compressed file path.
+// The name, the modification time and the comment are from the gzip header if available,
+// and the name is path without the extension otherwise.
+// The uncompressed size of gzip is from the trailer, so it is modulo 2^32 and of the last member if concatenated.
+// The uncompressed size of bzip2 is unknown without decompressing, so the size is -1.
+// The sizes, the mode and the modification time are of the opened file, the target if path is a symlink.
+func newCompressedEntry(c Compression, path string, info fs.FileInfo) (Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		name    = strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		modTime = stat.ModTime()
+		comment string
+		size    uint64
+		// fileSize is the size of the file info, -1 if unknown
+		fileSize int64 = -1
+	)
+	switch c {
+	case CompressionGzip:
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		if x := filepath.Base(r.Name); r.Name != "" && x != "." && x != string(filepath.Separator) {
+			name = x
+		}
+		if !r.ModTime.IsZero() {
+			modTime = r.ModTime
+		}
+		comment = r.Comment
+		var trailer [4]byte
+		if _, err := f.ReadAt(trailer[:], stat.Size()-4); err != nil {
+			return nil, err
+		}
+		size = uint64(binary.LittleEndian.Uint32(trailer[:]))
+		fileSize = int64(size)
+	case CompressionBzip2:
+		// decompressing is too costly to walk
+	default:
+		return nil, fmt.Errorf("%w: unknown compression: %s", ErrArchive, c)
+	}
+
+	return NewEntry(
+		filepath.Join(path, name),
+		&compressedFileInfo{
+			name:    name,
+			size:    fileSize,
+			modTime: modTime,
+			mode:    stat.Mode(),
+		},
+		EntryAttrs{
+			Chain: []string{path},
+			Compressed: NewCompressedEntry(
+				path,
+				name,
+				string(c),
+				uint64(stat.Size()),
+				size,
+				comment,
+			),
+		},
+	), nil
+}
+
+// OpenCompressed opens the decompressed content of the file in the compressed file.
+// ok is false if the entry is not the file in the compressed file.
+func OpenCompressed(entry Entry) (rc io.ReadCloser, ok bool, err error) {
+	x := entry.Compressed()
+	if x == nil {
+		return nil, false, nil
+	}
+	f, err := os.Open(x.Root())
+	if err != nil {
+		return nil, true, err
+	}
+	r, err := newDecompressor(Compression(x.Compression()), f)
+	if err != nil {
+		_ = f.Close()
+		return nil, true, err
+	}
+	return &compressedReader{
+		ReadCloser: r,
+		file:       f,
+	}, true, nil
+}
+
+type compressedReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *compressedReader) Close() error {
+	_ = r.ReadCloser.Close()
+	return r.file.Close()
+}
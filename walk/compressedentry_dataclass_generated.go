@@ -0,0 +1,44 @@
+// Code generated by "dataclass -type CompressedEntry -field Root string|RelPath string|Compression string|CompressedSize uint64|UncompressedSize uint64|Comment string -output compressedentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type CompressedEntry interface {
+	Root() string
+	RelPath() string
+	Compression() string
+	CompressedSize() uint64
+	UncompressedSize() uint64
+	Comment() string
+}
+type compressedEntry struct {
+	root             string
+	relPath          string
+	compression      string
+	compressedSize   uint64
+	uncompressedSize uint64
+	comment          string
+}
+
+func (s *compressedEntry) Root() string             { return s.root }
+func (s *compressedEntry) RelPath() string          { return s.relPath }
+func (s *compressedEntry) Compression() string      { return s.compression }
+func (s *compressedEntry) CompressedSize() uint64   { return s.compressedSize }
+func (s *compressedEntry) UncompressedSize() uint64 { return s.uncompressedSize }
+func (s *compressedEntry) Comment() string          { return s.comment }
+func NewCompressedEntry(
+	root string,
+	relPath string,
+	compression string,
+	compressedSize uint64,
+	uncompressedSize uint64,
+	comment string,
+) CompressedEntry {
+	return &compressedEntry{
+		root:             root,
+		relPath:          relPath,
+		compression:      compression,
+		compressedSize:   compressedSize,
+		uncompressedSize: uncompressedSize,
+		comment:          comment,
+	}
+}
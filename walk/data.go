@@ -1,49 +1,486 @@
 package walk
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"iter"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/berquerant/metafind/expr"
 	"github.com/berquerant/metafind/meta"
 )
 
-//go:generate go tool dataclass -type Entry -field "Path string|Info fs.FileInfo|Zip ZipEntry" -output entry_dataclass_generated.go
 //go:generate go tool dataclass -type ZipEntry -field "Root string|RelPath string|CompressedSize uint64|UncompressedSize uint64|Comment string|NonUTF8 bool" -output zipentry_dataclass_generated.go
+//go:generate go tool dataclass -type TarEntry -field "Root string|RelPath string|Typeflag string|Uid int|Gid int|Uname string|Gname string|Linkname string|PAXRecords map[string]string" -output tarentry_dataclass_generated.go
+//go:generate go tool dataclass -type IgnoreEntry -field "Ignored bool|Rule string|Source string" -output ignoreentry_dataclass_generated.go
+//go:generate go tool dataclass -type DirEntry -field "EntryCount int|FileCount int|SubdirCount int|TotalSize int64|NewestModTime time.Time" -output direntry_dataclass_generated.go
+//go:generate go tool dataclass -type ParentEntry -field "Path string|EntryCount int|FileCount int|SubdirCount int|Names []string|Markers map[string]bool" -output parententry_dataclass_generated.go
+//go:generate go tool dataclass -type CompressedEntry -field "Root string|RelPath string|Compression string|CompressedSize uint64|UncompressedSize uint64|Comment string" -output compressedentry_dataclass_generated.go
+//go:generate go tool dataclass -type ArEntry -field "Root string|RelPath string|Uid int|Gid int" -output arentry_dataclass_generated.go
+//go:generate go tool dataclass -type DebEntry -field "Name string|Version string|Architecture string|Depends []string|Control map[string]string" -output debentry_dataclass_generated.go
+//go:generate go tool dataclass -type LayerEntry -field "Image string|Platform string|Digest string|Index int|Shadowed bool|ShadowedBy string" -output layerentry_dataclass_generated.go
+//go:generate go tool dataclass -type ISOEntry -field "Root string|RelPath string|Extension string|RecordedTime time.Time|RockRidge bool|Uid int|Gid int|Nlink int|Linkname string|AccessTime time.Time|ChangeTime time.Time|CreationTime time.Time" -output isoentry_dataclass_generated.go
+//go:generate go tool dataclass -type GitEntry -field "Repo string|Revision string|Commit string|RelPath string|Mode string|ObjectType string|Object string" -output gitentry_dataclass_generated.go
 
+// Walker walks the entries under the root.
+// The errors are yielded with nil entries.
 type Walker interface {
-	Walk(root string) iter.Seq[Entry]
-	Err() error
+	Walk(ctx context.Context, root string) iter.Seq2[Entry, error]
 }
 
 const (
 	walkerBufferSize = 100
 )
 
+type walkResult struct {
+	entry Entry
+	err   error
+}
+
+// walkAsync runs f in a goroutine and yields the entries and the errors sent by f, and then the error returned by f.
+// send returns false when the context is done, then f should return.
+// The goroutine has finished when the iteration ends normally or is stopped by yield.
+// When ctx is done, the iteration ends without waiting for the goroutine, because f may be blocked by io;
+// the goroutine finishes after f returns.
+func walkAsync(ctx context.Context, f func(ctx context.Context, send func(Entry, error) bool) error) iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			resultC = make(chan walkResult, walkerBufferSize)
+			err     error
+		)
+		go func() {
+			defer close(resultC)
+			err = f(ctx, func(x Entry, err error) bool {
+				select {
+				case <-ctx.Done():
+					return false
+				case resultC <- walkResult{entry: x, err: err}:
+					return true
+				}
+			})
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case x, ok := <-resultC:
+				if !ok {
+					if err != nil {
+						yield(nil, err)
+					}
+					return
+				}
+				if !yield(x.entry, x.err) {
+					cancel()
+					for range resultC {
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// References tells which of the metadata costing the extra syscalls per entry are computed.
+type References struct {
+	// Access is readable, writable and executable by access(2).
+	Access bool
+	// BirthTime is btime and btime_ts by statx(2).
+	BirthTime bool
+	// Mount is mount_point, fs_type and mount_source by resolving the directories.
+	Mount bool
+}
+
+// AllReferences computes all the metadata.
+var AllReferences = References{
+	Access:    true,
+	BirthTime: true,
+	Mount:     true,
+}
+
+var (
+	// accessMetadataKeys are the keys of the metadata of References.Access.
+	accessMetadataKeys = []string{"readable", "writable", "executable"}
+	// birthTimeMetadataKeys are the keys of the metadata of References.BirthTime.
+	birthTimeMetadataKeys = []string{"btime", "btime_ts"}
+	// mountMetadataKeys are the keys of the metadata of References.Mount.
+	mountMetadataKeys = []string{"mount_point", "fs_type", "mount_source"}
+)
+
+// ReferencesOf returns the metadata referred by the expressions.
+// The nil expressions are ignored.
+// All the metadata are referred if any expression cannot tell the variables or refers to $env.
+func ReferencesOf(e ...any) References {
+	var r References
+	for _, x := range e {
+		if x == nil {
+			continue
+		}
+		names, ok := expr.Identifiers(x)
+		if !ok || slices.Contains(names, "$env") {
+			return AllReferences
+		}
+		for _, name := range names {
+			r.Access = r.Access || slices.Contains(accessMetadataKeys, name)
+			r.BirthTime = r.BirthTime || slices.Contains(birthTimeMetadataKeys, name)
+			r.Mount = r.Mount || slices.Contains(mountMetadataKeys, name)
+		}
+	}
+	return r
+}
+
+// Union returns the metadata referred by r or x.
+func (r References) Union(x References) References {
+	return References{
+		Access:    r.Access || x.Access,
+		BirthTime: r.BirthTime || x.BirthTime,
+		Mount:     r.Mount || x.Mount,
+	}
+}
+
+// NewMetaData returns the metadata of entry.
 func NewMetaData(entry Entry) *meta.Data {
+	return NewMetaDataOf(entry, AllReferences)
+}
+
+// NewMetaDataOf returns the metadata of entry, but computes the metadata costing the extra syscalls only if refs refers to them.
+func NewMetaDataOf(entry Entry, refs References) *meta.Data {
+	if data := entry.Meta(); data != nil {
+		// read from index
+		data.Merge(newSourceMetadata(entry.Source()))
+		data.SetOrigin(entry)
+		return data
+	}
+
+	data := meta.NewData(map[string]any{})
+	// read from stdin with json, overwritten by the others
+	data.Merge(entry.Extra())
+	data.Merge(newPathOnlyMetadata(entry, refs.Mount))
+	data.Merge(newInfoMetadata(entry.Info()))
+	data.Merge(newDirMetadata(entry.Dir()))
+	data.Merge(newStatMetadata(entry, refs.BirthTime))
+	data.Merge(newLinkMetadata(entry))
+	if refs.Access {
+		data.Merge(newAccessMetadata(entry))
+	}
+	data.Merge(newXattrMetadata(entry.Xattr()))
+	data.Merge(newZipMetadata(entry.Zip()))
+	data.Merge(newTarMetadata(entry.Tar()))
+	data.Merge(newCompressedMetadata(entry.Compressed()))
+	data.Merge(newArMetadata(entry.Ar()))
+	data.Merge(newDebMetadata(entry))
+	data.Merge(newLayerMetadata(entry.Layer()))
+	data.Merge(newISOMetadata(entry.ISO()))
+	data.Merge(newGitMetadata(entry.Git()))
+	data.Merge(newChainMetadata(entry))
+	data.Merge(newSourceMetadata(entry.Source()))
+	data.Merge(NewErrorMetadata(entry.Err()))
+	data.SetOrigin(entry)
+	return data
+}
+
+// EntryOf returns the entry the metadata is made from by NewMetaData.
+// ok is false if the metadata is not made from an entry.
+func EntryOf(v *meta.Data) (Entry, bool) {
+	e, ok := v.Origin().(Entry)
+	return e, ok && e != nil
+}
+
+// IsOnFileSystem returns true if the entry is a file on the file system,
+// not in the archives, the compressed files or the git repositories, nor read from the index.
+func IsOnFileSystem(e Entry) bool {
+	return e.Meta() == nil && len(e.Chain()) == 0 && e.Compressed() == nil && e.Git() == nil
+}
+
+// pathMetadataKeys are the keys of the metadata available without stat.
+var pathMetadataKeys = []string{
+	"path",
+	"dir",
+	"name",
+	"ext",
+	"basename",
+	"basepath",
+	"is_dir",
+	"root",
+	"relpath",
+	"depth",
+	"components",
+	"ignored",
+	"ignore_rule",
+	"ignore_source",
+	"mount_point",
+	"fs_type",
+	"mount_source",
+	"local_config",
+	"parent",
+}
+
+// newPathOnlyMetadata returns the metadata available without stat.
+// The mount is computed only if mount is true.
+func newPathOnlyMetadata(entry Entry, mount bool) *meta.Data {
+	data := newPathMetadata(entry)
+	// root and relpath of the archive entries are overwritten by the archive
+	data.Merge(newRootMetadata(entry))
+	if mount {
+		data.Merge(newMountMetadata(entry))
+	}
+	data.Merge(newIgnoreMetadata(entry.Ignore()))
+	data.Merge(newLocalConfigMetadata(entry.LocalConfig()))
+	data.Merge(newParentMetadata(entry.Parent()))
+	return data
+}
+
+func newPathMetadata(entry Entry) *meta.Data {
 	var (
 		path = entry.Path()
-		name = entry.Info().Name()
-		ext  = filepath.Ext(name)
+		name = filepath.Base(path)
 	)
+	if info := entry.Info(); info != nil {
+		name = info.Name()
+	}
+	ext := filepath.Ext(name)
+	return meta.NewData(map[string]any{
+		"path":     path,
+		"dir":      filepath.Dir(path),
+		"name":     name,
+		"ext":      ext,
+		"basename": strings.TrimSuffix(name, ext),
+		"basepath": strings.TrimSuffix(path, ext),
+	})
+}
+
+func newInfoMetadata(info fs.FileInfo) *meta.Data {
+	if info == nil {
+		// failed to stat
+		return nil
+	}
+	mode := info.Mode()
+	return meta.NewData(map[string]any{
+		"size":           info.Size(),
+		"is_dir":         info.IsDir(),
+		"mode":           fmt.Sprintf("%o", mode),
+		"mod_time":       info.ModTime().Format(time.DateTime),
+		"mod_time_ts":    info.ModTime().Unix(),
+		"perm":           int(mode.Perm()),
+		"type":           fileType(mode),
+		"setuid":         mode&fs.ModeSetuid != 0,
+		"setgid":         mode&fs.ModeSetgid != 0,
+		"sticky":         mode&fs.ModeSticky != 0,
+		"exec_user":      mode&0o100 != 0,
+		"world_writable": mode&0o002 != 0,
+	})
+}
+
+func fileType(mode fs.FileMode) string {
+	switch mode.Type() {
+	case 0:
+		return "regular"
+	case fs.ModeDir:
+		return "dir"
+	case fs.ModeSymlink:
+		return "symlink"
+	case fs.ModeSocket:
+		return "socket"
+	case fs.ModeNamedPipe:
+		return "fifo"
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return "char"
+	case fs.ModeDevice:
+		return "block"
+	default:
+		return "irregular"
+	}
+}
+
+// newLinkMetadata returns the symlink metadata of the entry on the file system.
+func newLinkMetadata(entry Entry) *meta.Data {
+	if len(entry.Chain()) > 0 {
+		// in archive
+		return nil
+	}
+	link := entry.Link()
+	if link == "" {
+		return meta.NewData(map[string]any{
+			"is_symlink":    false,
+			"link_target":   "",
+			"link_resolved": "",
+			"link_broken":   false,
+		})
+	}
+	resolved, ok := realPath(entry.Path())
+	return meta.NewData(map[string]any{
+		"is_symlink":    true,
+		"link_target":   link,
+		"link_resolved": resolved,
+		"link_broken":   !ok,
+	})
+}
+
+func newIgnoreMetadata(entry IgnoreEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"ignored":       entry.Ignored(),
+		"ignore_rule":   entry.Rule(),
+		"ignore_source": entry.Source(),
+	})
+}
+
+// newDirMetadata returns the statistics of the directory yielded with dirs.
+func newDirMetadata(dir DirEntry) *meta.Data {
+	if dir == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"entry_count":        dir.EntryCount(),
+		"file_count":         dir.FileCount(),
+		"subdir_count":       dir.SubdirCount(),
+		"total_size":         dir.TotalSize(),
+		"newest_mod_time":    dir.NewestModTime().Format(time.DateTime),
+		"newest_mod_time_ts": dir.NewestModTime().Unix(),
+	})
+}
+
+func newParentMetadata(parent ParentEntry) *meta.Data {
+	if parent == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"parent": map[string]any{
+			"path":         parent.Path(),
+			"name":         filepath.Base(parent.Path()),
+			"entry_count":  parent.EntryCount(),
+			"file_count":   parent.FileCount(),
+			"subdir_count": parent.SubdirCount(),
+			"names":        parent.Names(),
+			"markers":      parent.Markers(),
+		},
+	})
+}
+
+func newLocalConfigMetadata(paths []string) *meta.Data {
+	if len(paths) == 0 {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"local_config": paths,
+	})
+}
+
+func newXattrMetadata(attrs map[string]string) *meta.Data {
+	if attrs == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"xattr": attrs,
+	})
+}
+
+// NewErrorMetadata returns the error message, the errno and the path and the operation of fs.PathError.
+func NewErrorMetadata(err error) *meta.Data {
+	if err == nil {
+		return nil
+	}
 	data := meta.NewData(map[string]any{
-		"path":        path,
-		"dir":         filepath.Dir(path),
-		"name":        name,
-		"ext":         ext,
-		"basename":    strings.TrimSuffix(name, ext),
-		"basepath":    strings.TrimSuffix(path, ext),
-		"size":        entry.Info().Size(),
-		"mode":        fmt.Sprintf("%o", entry.Info().Mode()),
-		"mod_time":    entry.Info().ModTime().Format(time.DateTime),
-		"mod_time_ts": entry.Info().ModTime().Unix(),
+		"error": err.Error(),
 	})
-	data.Merge(newZipMetadata(entry.Zip()))
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		data.Set("path", pathErr.Path)
+		data.Set("op", pathErr.Op)
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		data.Set("errno", int(errno))
+	}
+	return data
+}
+
+func newSourceMetadata(source string) *meta.Data {
+	if source == "" {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"source": source,
+	})
+}
+
+// newRootMetadata returns the root of the entry, and the path relative to the root if the entry is on the file system.
+func newRootMetadata(entry Entry) *meta.Data {
+	root := entry.Root()
+	if root == "" && entry.Source() != "" {
+		if scheme, path := ParseRoot(entry.Source()); scheme != SchemeStdin {
+			root = path
+		}
+	}
+	if root == "" {
+		return nil
+	}
+	data := meta.NewData(map[string]any{
+		"root": root,
+	})
+	if len(entry.Chain()) > 0 {
+		// in archive
+		return data
+	}
+	rel, err := filepath.Rel(root, entry.Path())
+	if err != nil {
+		return data
+	}
+	components := []string{}
+	if rel != "." {
+		components = strings.Split(rel, string(filepath.Separator))
+	}
+	data.Set("relpath", rel)
+	data.Set("depth", len(components))
+	data.Set("components", components)
 	return data
 }
 
+func archiveRelPath(entry Entry) string {
+	switch {
+	case entry.Zip() != nil:
+		return entry.Zip().RelPath()
+	case entry.Tar() != nil:
+		return entry.Tar().RelPath()
+	case entry.Compressed() != nil:
+		return entry.Compressed().RelPath()
+	case entry.Ar() != nil:
+		return entry.Ar().RelPath()
+	case entry.ISO() != nil:
+		return entry.ISO().RelPath()
+	case entry.Git() != nil:
+		return entry.Git().RelPath()
+	default:
+		return ""
+	}
+}
+
+func newChainMetadata(entry Entry) *meta.Data {
+	chain := entry.Chain()
+	if len(chain) == 0 {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"archive_chain":  strings.Join(append(slices.Clone(chain), archiveRelPath(entry)), ArchiveSep),
+		"archive_parent": strings.Join(chain, ArchiveSep),
+		"archive_depth":  len(chain) - 1,
+	})
+}
+
 func newZipMetadata(entry ZipEntry) *meta.Data {
 	if entry == nil {
 		return nil
@@ -58,6 +495,149 @@ func newZipMetadata(entry ZipEntry) *meta.Data {
 	})
 }
 
+func newTarMetadata(entry TarEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"root":        entry.Root(),
+		"relpath":     entry.RelPath(),
+		"typeflag":    entry.Typeflag(),
+		"uid":         entry.Uid(),
+		"gid":         entry.Gid(),
+		"uname":       entry.Uname(),
+		"gname":       entry.Gname(),
+		"linkname":    entry.Linkname(),
+		"pax_records": entry.PAXRecords(),
+	})
+}
+
+func newCompressedMetadata(entry CompressedEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	d := map[string]any{
+		"root":            entry.Root(),
+		"relpath":         entry.RelPath(),
+		"compression":     entry.Compression(),
+		"compressed_path": entry.Root(),
+		"compressed_size": entry.CompressedSize(),
+		"comment":         entry.Comment(),
+	}
+	if Compression(entry.Compression()).hasSize() {
+		d["uncompressed_size"] = entry.UncompressedSize()
+	}
+	return meta.NewData(d)
+}
+
+func newArMetadata(entry ArEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"root":    entry.Root(),
+		"relpath": entry.RelPath(),
+		"uid":     entry.Uid(),
+		"gid":     entry.Gid(),
+	})
+}
+
+// newDebMetadata returns the fields of the control file of the deb package shipping the file,
+// and the path of the file installed by the package.
+func newDebMetadata(entry Entry) *meta.Data {
+	deb := entry.Deb()
+	if deb == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"deb_package":      deb.Name(),
+		"deb_version":      deb.Version(),
+		"deb_architecture": deb.Architecture(),
+		"deb_depends":      deb.Depends(),
+		"deb_control":      deb.Control(),
+		"deb_file":         path.Clean("/" + archiveRelPath(entry)),
+	})
+}
+
+func newLayerMetadata(entry LayerEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"image":             entry.Image(),
+		"image_platform":    entry.Platform(),
+		"layer_digest":      entry.Digest(),
+		"layer_index":       entry.Index(),
+		"layer_shadowed":    entry.Shadowed(),
+		"layer_shadowed_by": entry.ShadowedBy(),
+	})
+}
+
+// newISOMetadata returns the metadata of the file in ISO9660 image.
+// The owner, the link and the timestamps are available only with Rock Ridge.
+func newISOMetadata(entry ISOEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	data := meta.NewData(map[string]any{
+		"root":             entry.Root(),
+		"relpath":          entry.RelPath(),
+		"iso_extension":    entry.Extension(),
+		"recorded_time":    entry.RecordedTime().Format(time.DateTime),
+		"recorded_time_ts": entry.RecordedTime().Unix(),
+	})
+	if !entry.RockRidge() {
+		return data
+	}
+	data.Set("uid", entry.Uid())
+	data.Set("gid", entry.Gid())
+	data.Set("nlink", entry.Nlink())
+	data.Set("linkname", entry.Linkname())
+	for key, t := range map[string]time.Time{
+		"atime": entry.AccessTime(),
+		"ctime": entry.ChangeTime(),
+		"btime": entry.CreationTime(),
+	} {
+		if t.IsZero() {
+			continue
+		}
+		data.Set(key, t.Format(time.DateTime))
+		data.Set(key+"_ts", t.Unix())
+	}
+	return data
+}
+
+// newGitMetadata returns the metadata of the file in the tree of the git repository.
+func newGitMetadata(entry GitEntry) *meta.Data {
+	if entry == nil {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"root":         entry.Repo(),
+		"relpath":      entry.RelPath(),
+		"git_repo":     entry.Repo(),
+		"git_revision": entry.Revision(),
+		"git_commit":   entry.Commit(),
+		"git_mode":     entry.Mode(),
+		"git_type":     entry.ObjectType(),
+		"git_object":   entry.Object(),
+	})
+}
+
+// OpenContent opens the content of the file not on the file system, i.e. in the compressed file or in the git repository.
+// ok is false if the file is on the file system.
+// The file is told by the entry the metadata is made from, not by the metadata that may be given by the index or stdin-json.
+func OpenContent(ctx context.Context, v *meta.Data) (rc io.ReadCloser, ok bool, err error) {
+	entry, ok := EntryOf(v)
+	if !ok {
+		return nil, false, nil
+	}
+	if rc, ok, err = OpenCompressed(entry); ok {
+		return
+	}
+	return OpenGitBlob(ctx, entry)
+}
+
 func GetPathFromMetadata(v *meta.Data) string {
 	x, _ := v.Get("path")
 	return x.(string)
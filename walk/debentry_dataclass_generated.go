@@ -0,0 +1,39 @@
+// Code generated by "dataclass -type DebEntry -field Name string|Version string|Architecture string|Depends []string|Control map[string]string -output debentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type DebEntry interface {
+	Name() string
+	Version() string
+	Architecture() string
+	Depends() []string
+	Control() map[string]string
+}
+type debEntry struct {
+	name         string
+	version      string
+	architecture string
+	depends      []string
+	control      map[string]string
+}
+
+func (s *debEntry) Name() string               { return s.name }
+func (s *debEntry) Version() string            { return s.version }
+func (s *debEntry) Architecture() string       { return s.architecture }
+func (s *debEntry) Depends() []string          { return s.depends }
+func (s *debEntry) Control() map[string]string { return s.control }
+func NewDebEntry(
+	name string,
+	version string,
+	architecture string,
+	depends []string,
+	control map[string]string,
+) DebEntry {
+	return &debEntry{
+		name:         name,
+		version:      version,
+		architecture: architecture,
+		depends:      depends,
+		control:      control,
+	}
+}
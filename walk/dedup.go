@@ -0,0 +1,93 @@
+package walk
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dedup is the way to identify the same file reached from the different roots.
+type Dedup string
+
+const (
+	// DedupNone disables de-duplication.
+	DedupNone Dedup = ""
+	// DedupPath identifies the files by the real paths, resolving the symlinks.
+	DedupPath Dedup = "path"
+	// DedupInode identifies the files by the device and the inode.
+	DedupInode Dedup = "inode"
+)
+
+var (
+	ErrUnknownDedup = errors.New("UnknownDedup")
+)
+
+func ParseDedup(s string) (Dedup, error) {
+	switch d := Dedup(s); d {
+	case DedupNone, DedupPath, DedupInode:
+		return d, nil
+	default:
+		return DedupNone, fmt.Errorf("%w: %s", ErrUnknownDedup, s)
+	}
+}
+
+// Key returns the identity of the file of entry.
+// Returns false if entry should not be de-duplicated, e.g. the entry with the error.
+//
+// The entries in archives are identified by the outermost archive and the archive chain,
+// and the entries from index are identified by the paths.
+func (d Dedup) Key(entry Entry) (string, bool) {
+	if d == DedupNone || entry.Err() != nil {
+		return "", false
+	}
+	if entry.Meta() != nil {
+		// read from index
+		return entry.Path(), true
+	}
+
+	path := entry.Path()
+	var suffix string
+	if chain := entry.Chain(); len(chain) > 0 {
+		path = chain[0]
+		suffix = strings.Join(append(chain[1:len(chain):len(chain)], archiveRelPath(entry)), ArchiveSep)
+	}
+
+	var (
+		key string
+		ok  bool
+	)
+	switch d {
+	case DedupPath:
+		key, ok = realPath(path)
+	case DedupInode:
+		info := entry.Info()
+		if len(entry.Chain()) > 0 || info == nil || info.Mode()&fs.ModeSymlink != 0 {
+			var err error
+			if info, err = os.Stat(path); err != nil {
+				return "", false
+			}
+		}
+		key, ok = fileID(info)
+	}
+	if !ok {
+		return "", false
+	}
+	if suffix != "" {
+		key += ArchiveSep + suffix
+	}
+	return key, true
+}
+
+func realPath(path string) (string, bool) {
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if p, err = filepath.EvalSymlinks(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
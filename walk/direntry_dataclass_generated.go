@@ -0,0 +1,41 @@
+// Code generated by "dataclass -type DirEntry -field EntryCount int|FileCount int|SubdirCount int|TotalSize int64|NewestModTime time.Time -output direntry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+import "time"
+
+type DirEntry interface {
+	EntryCount() int
+	FileCount() int
+	SubdirCount() int
+	TotalSize() int64
+	NewestModTime() time.Time
+}
+type dirEntry struct {
+	entryCount    int
+	fileCount     int
+	subdirCount   int
+	totalSize     int64
+	newestModTime time.Time
+}
+
+func (s *dirEntry) EntryCount() int          { return s.entryCount }
+func (s *dirEntry) FileCount() int           { return s.fileCount }
+func (s *dirEntry) SubdirCount() int         { return s.subdirCount }
+func (s *dirEntry) TotalSize() int64         { return s.totalSize }
+func (s *dirEntry) NewestModTime() time.Time { return s.newestModTime }
+func NewDirEntry(
+	entryCount int,
+	fileCount int,
+	subdirCount int,
+	totalSize int64,
+	newestModTime time.Time,
+) DirEntry {
+	return &dirEntry{
+		entryCount:    entryCount,
+		fileCount:     fileCount,
+		subdirCount:   subdirCount,
+		totalSize:     totalSize,
+		newestModTime: newestModTime,
+	}
+}
@@ -0,0 +1,123 @@
+package walk
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// dirStat is the statistics of a directory being walked.
+// Only the walked entries are counted, not the rejected or the pruned ones.
+// The directory is sent with the statistics when it and all the subdirectories are walked.
+type dirStat struct {
+	mu     sync.Mutex
+	entry  Entry
+	parent *dirStat
+	// send is false if the directory should not be sent, e.g. shallower than minDepth
+	send bool
+	// pending is the number of the walks not finished, the directory itself and the subdirectories
+	pending       int
+	entryCount    int
+	fileCount     int
+	subdirCount   int
+	totalSize     int64
+	newestModTime time.Time
+}
+
+func newDirStat(entry Entry, parent *dirStat, send bool) *dirStat {
+	s := &dirStat{
+		entry:   entry,
+		parent:  parent,
+		send:    send,
+		pending: 1,
+	}
+	if info := entry.Info(); info != nil {
+		s.newestModTime = info.ModTime()
+	}
+	return s
+}
+
+// add counts the entry of the directory.
+func (s *dirStat) add(info fs.FileInfo) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entryCount++
+	if info.IsDir() {
+		s.subdirCount++
+	} else {
+		s.fileCount++
+		s.totalSize += info.Size()
+	}
+	if t := info.ModTime(); t.After(s.newestModTime) {
+		s.newestModTime = t
+	}
+}
+
+// discard makes the directory not to be sent, e.g. failed to read.
+func (s *dirStat) discard() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send = false
+}
+
+// enter marks the subdirectory to be walked.
+func (s *dirStat) enter() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending++
+}
+
+// merge adds the statistics of the subtree of the subdirectory.
+func (s *dirStat) merge(x *dirStat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.totalSize += x.totalSize
+	if x.newestModTime.After(s.newestModTime) {
+		s.newestModTime = x.newestModTime
+	}
+}
+
+// done marks the directory or a subdirectory walked.
+// The directory is sent and merged into the parent when all the walks are finished.
+func (s *dirStat) done(send func(Entry, error) bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pending--
+	var (
+		finished = s.pending == 0
+		sendable = s.send
+	)
+	s.mu.Unlock()
+	if !finished {
+		return
+	}
+
+	if sendable {
+		WalkEntryCount.Incr()
+		_ = send(withDir(s.entry, NewDirEntry(
+			s.entryCount,
+			s.fileCount,
+			s.subdirCount,
+			s.totalSize,
+			s.newestModTime,
+		)), nil)
+	}
+	if s.parent != nil {
+		s.parent.merge(s)
+		s.parent.done(send)
+	}
+}
+
+func withDir(entry Entry, dir DirEntry) Entry {
+	attrs := entry.Attrs()
+	attrs.Dir = dir
+	return NewEntry(entry.Path(), entry.Info(), attrs)
+}
@@ -0,0 +1,101 @@
+package walk
+
+import (
+	"io/fs"
+
+	"github.com/berquerant/metafind/meta"
+)
+
+// Entry is the file yielded by Walker.
+type Entry interface {
+	Path() string
+	Info() fs.FileInfo
+	// Attrs returns all the attributes but the path and the info.
+	Attrs() EntryAttrs
+	Zip() ZipEntry
+	Tar() TarEntry
+	Chain() []string
+	Meta() *meta.Data
+	Source() string
+	Err() error
+	Link() string
+	Xattr() map[string]string
+	Root() string
+	Ignore() IgnoreEntry
+	LocalConfig() []string
+	Dir() DirEntry
+	Parent() ParentEntry
+	Extra() *meta.Data
+	Compressed() CompressedEntry
+	Ar() ArEntry
+	Deb() DebEntry
+	Layer() LayerEntry
+	ISO() ISOEntry
+	Git() GitEntry
+}
+
+// EntryAttrs are the optional attributes of Entry.
+// The zero value means the attribute is not available.
+type EntryAttrs struct {
+	Zip         ZipEntry
+	Tar         TarEntry
+	Chain       []string
+	Meta        *meta.Data
+	Source      string
+	Err         error
+	Link        string
+	Xattr       map[string]string
+	Root        string
+	Ignore      IgnoreEntry
+	LocalConfig []string
+	Dir         DirEntry
+	Parent      ParentEntry
+	Extra       *meta.Data
+	Compressed  CompressedEntry
+	Ar          ArEntry
+	Deb         DebEntry
+	Layer       LayerEntry
+	ISO         ISOEntry
+	Git         GitEntry
+
+	// mount is the mount of the directory of the entry on the file system
+	mount *dirMount
+}
+
+func NewEntry(path string, info fs.FileInfo, attrs EntryAttrs) Entry {
+	return &entry{
+		path:  path,
+		info:  info,
+		attrs: attrs,
+	}
+}
+
+type entry struct {
+	path  string
+	info  fs.FileInfo
+	attrs EntryAttrs
+}
+
+func (s *entry) Path() string                { return s.path }
+func (s *entry) Info() fs.FileInfo           { return s.info }
+func (s *entry) Attrs() EntryAttrs           { return s.attrs }
+func (s *entry) Zip() ZipEntry               { return s.attrs.Zip }
+func (s *entry) Tar() TarEntry               { return s.attrs.Tar }
+func (s *entry) Chain() []string             { return s.attrs.Chain }
+func (s *entry) Meta() *meta.Data            { return s.attrs.Meta }
+func (s *entry) Source() string              { return s.attrs.Source }
+func (s *entry) Err() error                  { return s.attrs.Err }
+func (s *entry) Link() string                { return s.attrs.Link }
+func (s *entry) Xattr() map[string]string    { return s.attrs.Xattr }
+func (s *entry) Root() string                { return s.attrs.Root }
+func (s *entry) Ignore() IgnoreEntry         { return s.attrs.Ignore }
+func (s *entry) LocalConfig() []string       { return s.attrs.LocalConfig }
+func (s *entry) Dir() DirEntry               { return s.attrs.Dir }
+func (s *entry) Parent() ParentEntry         { return s.attrs.Parent }
+func (s *entry) Extra() *meta.Data           { return s.attrs.Extra }
+func (s *entry) Compressed() CompressedEntry { return s.attrs.Compressed }
+func (s *entry) Ar() ArEntry                 { return s.attrs.Ar }
+func (s *entry) Deb() DebEntry               { return s.attrs.Deb }
+func (s *entry) Layer() LayerEntry           { return s.attrs.Layer }
+func (s *entry) ISO() ISOEntry               { return s.attrs.ISO }
+func (s *entry) Git() GitEntry               { return s.attrs.Git }
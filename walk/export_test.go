@@ -0,0 +1,48 @@
+package walk
+
+import (
+	"io"
+	"io/fs"
+)
+
+// Mount is mount with the exported fields.
+type Mount struct {
+	Point  string
+	FSType string
+	Source string
+}
+
+func ParseMountInfo(r io.Reader) ([]Mount, error) {
+	mounts, err := parseMountInfo(r)
+	xs := make([]Mount, len(mounts))
+	for i, m := range mounts {
+		xs[i] = Mount{
+			Point:  m.point,
+			FSType: m.fsType,
+			Source: m.source,
+		}
+	}
+	return xs, err
+}
+
+var UnescapeMountInfo = unescapeMountInfo
+
+// FindMount returns the mount containing path in the mountinfo r.
+func FindMount(r io.Reader, path string) (Mount, bool) {
+	mounts, _ := parseMountInfo(r)
+	m, ok := newMountTable(mounts).find(path)
+	return Mount{
+		Point:  m.point,
+		FSType: m.fsType,
+		Source: m.source,
+	}, ok
+}
+
+// SetFileDevice replaces the device of the files for xdev, and returns the function to restore it.
+func SetFileDevice(f func(fs.FileInfo) (uint64, bool)) (restore func()) {
+	orig := fileDevice
+	fileDevice = f
+	return func() {
+		fileDevice = orig
+	}
+}
@@ -2,50 +2,284 @@ package walk
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"iter"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/berquerant/metafind/expr"
 	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/meta"
 	"github.com/berquerant/metafind/metric"
+	"github.com/berquerant/metafind/syncx"
 )
 
-var _ Walker = &FileWalker{}
+var _ FileEntryWalker = &FileWalker{}
 
-func NewFile(exclude expr.Expr) *FileWalker {
-	return &FileWalker{
-		exclude: exclude,
+type FileOption func(*FileWalker)
+
+// WithArchive makes FileWalker walk the archive files selected by archive as directories.
+// The entries of the archives are yielded instead of the archive files.
+func WithArchive(archive expr.Expr, opt ...ArchiveOption) FileOption {
+	return func(w *FileWalker) {
+		w.archive = archive
+		w.archiveRefs = ReferencesOf(archive)
+		w.archiveOpts = opt
+	}
+}
+
+// WithErrorEntry makes FileWalker yield the paths failed to walk as the entries with the errors
+// instead of yielding the errors.
+func WithErrorEntry(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.errorEntry = enabled
+	}
+}
+
+// WithParallel makes FileWalker read directories by n goroutines.
+// The order of the entries is not deterministic when n > 1.
+// n < 1 means 1.
+func WithParallel(n int) FileOption {
+	return func(w *FileWalker) {
+		w.parallel = max(n, 1)
+	}
+}
+
+// WithFollowSymlinks makes FileWalker follow the symlinks.
+// The directory loops are detected by the devices and the inodes, and reported as ErrSymlinkLoop.
+func WithFollowSymlinks(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.followSymlinks = enabled
+	}
+}
+
+// WithXattr makes FileWalker read the extended attributes whose names start with prefix.
+// All the attributes are read if prefix is empty.
+func WithXattr(enabled bool, prefix string) FileOption {
+	return func(w *FileWalker) {
+		w.xattr = enabled
+		w.xattrPrefix = prefix
+	}
+}
+
+// WithXdev makes FileWalker stay on the device of the root, not descending into the directories on the other devices.
+func WithXdev(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.xdev = enabled
+	}
+}
+
+// WithGitignore makes FileWalker read the ignore rules from .gitignore and .ignore
+// in the directories under the root, and skip .git.
+// If the root is in a git repository, info/exclude of the repository
+// and the ignore files of the ancestor directories up to the repository root are also read.
+func WithGitignore(gitignore Gitignore) FileOption {
+	return func(w *FileWalker) {
+		w.gitignore = gitignore
+	}
+}
+
+// WithPrune makes FileWalker skip the files and the directories whose names match the patterns,
+// before evaluating the exclude expression.
+// The patterns are resolved from the presets by ResolvePresets.
+func WithPrune(patterns []string) FileOption {
+	return func(w *FileWalker) {
+		w.prunePatterns = patterns
+	}
+}
+
+// WithDepth makes FileWalker yield the entries at depth from minDepth to maxDepth, the root is at depth 0.
+// maxDepth < 0 means no limit.
+// The directories at maxDepth are not descended.
+func WithDepth(minDepth, maxDepth int) FileOption {
+	return func(w *FileWalker) {
+		w.minDepth = minDepth
+		w.maxDepth = maxDepth
+	}
+}
+
+// WithLocalConfig makes FileWalker read LocalConfigName in the directories under the root.
+// The excludes of the local configs are applied to the subtrees,
+// and the entries record the paths of the local configs applied to them.
+func WithLocalConfig(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.localConfig = enabled
 	}
 }
 
+// WithDirs makes FileWalker yield the directories as entries with the statistics of their subtrees.
+// The directories are yielded after their subtrees are walked.
+// The directories not descended by maxDepth or xdev are yielded without the statistics.
+func WithDirs(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.dirs = enabled
+	}
+}
+
+// WithParent makes FileWalker add the metadata of the directory to its entries,
+// which are the number of the entries, the names of the entries and whether the entries matching markers exist.
+// The markers are matched against the names of the entries by filepath.Match.
+// The metadata is computed once per directory and shared by its entries.
+func WithParent(enabled bool, markers []string) FileOption {
+	return func(w *FileWalker) {
+		w.parent = enabled
+		w.parentMarkers = markers
+	}
+}
+
+// WithDecompress makes FileWalker treat the gzip and bzip2 files except the compressed tar files
+// as wrapping one file, and yield the file instead of the compressed files.
+func WithDecompress(enabled bool) FileOption {
+	return func(w *FileWalker) {
+		w.decompress = enabled
+	}
+}
+
+var (
+	ErrSymlinkLoop = errors.New("SymlinkLoop")
+)
+
+func NewFile(exclude expr.Expr, opt ...FileOption) *FileWalker {
+	w := &FileWalker{
+		exclude:         exclude,
+		excludePathOnly: !needsStat(exclude),
+		excludeRefs:     ReferencesOf(exclude),
+		parallel:        1,
+		maxDepth:        -1,
+		localConfigs:    &localConfigCache{},
+	}
+	for _, f := range opt {
+		f(w)
+	}
+	return w
+}
+
 // FileWalker walks only files under the root.
 type FileWalker struct {
-	err     error
 	exclude expr.Expr
+	// excludePathOnly is true if exclude requires only the metadata available without stat.
+	excludePathOnly bool
+	// excludeRefs are the costly metadata referred by exclude.
+	excludeRefs    References
+	archive        expr.Expr
+	archiveRefs    References
+	archiveOpts    []ArchiveOption
+	errorEntry     bool
+	parallel       int
+	followSymlinks bool
+	xattr          bool
+	xattrPrefix    string
+	xdev           bool
+	minDepth       int
+	gitignore      Gitignore
+	prunePatterns  []string
+	maxDepth       int
+	localConfig    bool
+	localConfigs   *localConfigCache
+	dirs           bool
+	parent         bool
+	parentMarkers  []string
+	decompress     bool
 }
 
-func (w FileWalker) Err() error { return w.err }
-
-func (w *FileWalker) isRejected(entry Entry) bool {
-	if w.exclude == nil {
+// needsStat returns true if e may refer to the metadata from stat.
+func needsStat(e expr.Expr) bool {
+	if e == nil {
 		return false
 	}
+	names, ok := expr.Identifiers(e)
+	if !ok {
+		return true
+	}
+	for _, x := range names {
+		if !slices.Contains(pathMetadataKeys, x) {
+			return true
+		}
+	}
+	return false
+}
 
-	data := NewMetaData(entry)
-	data.Set("is_dir", entry.Info().IsDir())
-	rejected, err := w.exclude.Run(data.Unwrap())
-	if err != nil {
-		WalkExcludeErrCount.Incr()
-		slog.Warn("FileWalker: exclude", slog.String("path", entry.Path()), logx.Err(err))
+// isRejected returns true if the exclude or the excludes of the local configs reject entry.
+func (w *FileWalker) isRejected(entry Entry, locals []*LocalConfig) bool {
+	var (
+		pathData, data *meta.Data
+		refs           = w.excludeRefs
+	)
+	for _, x := range locals {
+		refs = refs.Union(x.excludeRefs)
+	}
+	run := func(exclude expr.Expr, pathOnly bool) bool {
+		if exclude == nil {
+			return false
+		}
+		switch {
+		case pathOnly && pathData == nil:
+			pathData = newPathOnlyMetadata(entry, refs.Mount)
+			pathData.Set("is_dir", entry.Info().IsDir())
+		case !pathOnly && data == nil:
+			data = NewMetaDataOf(entry, refs)
+			data.Set("is_dir", entry.Info().IsDir())
+		}
+		env := data
+		if pathOnly {
+			env = pathData
+		}
+		rejected, err := exclude.Run(env.Unwrap())
+		if err != nil {
+			WalkExcludeErrCount.Incr()
+			slog.Warn("FileWalker: exclude", slog.String("path", entry.Path()), logx.Err(err))
+			return true
+		}
+		if rejected {
+			WalkExcludeCount.Incr()
+		}
+		return rejected
+	}
+
+	if run(w.exclude, w.excludePathOnly) {
 		return true
 	}
-	if rejected {
-		WalkExcludeCount.Incr()
+	for _, x := range locals {
+		if run(x.exclude, x.excludePathOnly) {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchive returns true if entry is an archive file to be walked.
+func (w *FileWalker) isArchive(entry Entry) bool {
+	if w.archive == nil || archiveKindOf(entry.Info().Name()) == archiveUnknown {
+		return false
+	}
+	data := NewMetaDataOf(entry, w.archiveRefs)
+	data.Set("is_dir", false)
+	ok, err := w.archive.Run(data.Unwrap())
+	if err != nil {
+		slog.Warn("FileWalker: archive", slog.String("path", entry.Path()), logx.Err(err))
+		return false
+	}
+	return ok
+}
+
+// fail sends the error of path, or the entry with the error if errorEntry is enabled.
+func (w *FileWalker) fail(path string, info fs.FileInfo, err error, send func(Entry, error) bool) bool {
+	WalkErrCount.Incr()
+	if !errors.As(err, new(*fs.PathError)) {
+		err = &fs.PathError{
+			Op:   "walk",
+			Path: path,
+			Err:  err,
+		}
+	}
+	if w.errorEntry {
+		return send(NewEntry(path, info, EntryAttrs{Err: err}), nil)
 	}
-	return rejected
+	return send(nil, err)
 }
 
 var (
@@ -55,58 +289,270 @@ var (
 	WalkEntryCount      = metric.NewCounter("WalkEntry")
 	WalkExcludeCount    = metric.NewCounter("WalkExclude")
 	WalkExcludeErrCount = metric.NewCounter("WalkExcludeErr")
+	WalkArchiveCount    = metric.NewCounter("WalkArchive")
+	WalkErrCount        = metric.NewCounter("WalkErr")
+	WalkIgnoreCount     = metric.NewCounter("WalkIgnore")
+	WalkPruneCount      = metric.NewCounter("WalkPrune")
+	WalkCompressedCount = metric.NewCounter("WalkCompressed")
+	// WalkLocalConfigCount is the number of the local configs read.
+	WalkLocalConfigCount = metric.NewCounter("WalkLocalConfig")
 )
 
-func (w *FileWalker) Walk(root string) iter.Seq[Entry] {
+type visitResult int
+
+const (
+	visitNext visitResult = iota
+	visitDescend
+	visitStop
+)
+
+// resolve returns the target of the symlink path and the info of path.
+// The info is of the target if followSymlinks is enabled and the link is not broken.
+func (w *FileWalker) resolve(path string, info fs.FileInfo) (string, fs.FileInfo) {
+	if !isSymlink(info) {
+		return "", info
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		slog.Debug("FileWalker: readlink", slog.String("path", path), logx.Err(err))
+	}
+	if !w.followSymlinks {
+		return target, info
+	}
+	if x, err := os.Stat(path); err == nil {
+		return target, x
+	}
+	// broken link
+	return target, info
+}
+
+func isSymlink(info fs.FileInfo) bool {
+	if x, ok := info.(*dirEntryInfo); ok {
+		// avoid lstat
+		return x.entry.Type()&fs.ModeSymlink != 0
+	}
+	return info.Mode()&fs.ModeSymlink != 0
+}
+
+// readXattr returns the extended attributes of path if enabled.
+// Returns an empty map if failed to read them.
+func (w *FileWalker) readXattr(path string, info fs.FileInfo) map[string]string {
+	if !w.xattr {
+		return nil
+	}
+	attrs, err := readXattr(path, w.xattrPrefix, !isSymlink(info))
+	if err != nil {
+		slog.Debug("FileWalker: xattr", slog.String("path", path), logx.Err(err))
+		return map[string]string{}
+	}
+	return attrs
+}
+
+// newEntry returns the entry of path under root on the file system.
+// dir is the state of the directory of path, nil if unknown.
+func (w *FileWalker) newEntry(root, path string, info fs.FileInfo, ignore IgnoreEntry, dir *dirContext) Entry {
+	link, info := w.resolve(path, info)
+	return NewEntry(
+		path,
+		info,
+		EntryAttrs{
+			Link:        link,
+			Xattr:       w.readXattr(path, info),
+			Root:        root,
+			Ignore:      ignore,
+			LocalConfig: localConfigPaths(dir.localConfigs()),
+			Parent:      dir.parentEntry(),
+			mount:       dir.dirMount(),
+		},
+	)
+}
+
+// FileEntry returns the entry of the file path as the root.
+func (w *FileWalker) FileEntry(path string, info fs.FileInfo) Entry {
+	return w.newEntry(path, path, info, nil, nil)
+}
+
+// walkRoot is the root of a walk.
+type walkRoot struct {
+	path string
+	// dev is the device of the root if xdev is enabled, otherwise 0.
+	dev uint64
+}
+
+func (w *FileWalker) newWalkRoot(root string) *walkRoot {
+	r := &walkRoot{
+		path: root,
+	}
+	if !w.xdev {
+		return r
+	}
+	if info, err := os.Stat(root); err == nil {
+		r.dev, _ = fileDevice(info)
+	}
+	return r
+}
+
+// fileDevice returns the device of info for xdev.
+// It is a variable to fake the devices in the tests.
+var fileDevice = fileDev
+
+// isOtherDevice returns true if info is not on the device of the root.
+func (r *walkRoot) isOtherDevice(info fs.FileInfo) bool {
+	if r.dev == 0 {
+		return false
+	}
+	dev, ok := fileDevice(info)
+	return ok && dev != r.dev
+}
+
+// visit sends the entry of path at depth under root unless it is pruned, rejected, a directory or shallower than minDepth.
+// The directory is not descended if it is at maxDepth or on the other device than the root with xdev,
+// and it is sent if dirs is enabled.
+// ignore is the ignore rule matching path, nil if gitignore is disabled.
+// dir is the state of the directory of path, nil if unknown.
+// Returns the entry of the directory to descend.
+func (w *FileWalker) visit(
+	ctx context.Context,
+	root *walkRoot,
+	path string,
+	depth int,
+	info fs.FileInfo,
+	ignore IgnoreEntry,
+	dir *dirContext,
+	send func(Entry, error) bool,
+) (visitResult, Entry) {
+	if depth > 0 && w.isPruned(info.Name()) {
+		WalkPruneCount.Incr()
+		return visitNext, nil
+	}
+	entry := w.newEntry(root.path, path, info, ignore, dir)
+	info = entry.Info()
+	if w.isRejected(entry, dir.localConfigs()) {
+		return visitNext, nil
+	}
+	dir.dirStat().add(info)
+
+	if info.IsDir() {
+		WalkDirCount.Incr()
+		descend := true
+		if w.maxDepth >= 0 && depth >= w.maxDepth {
+			descend = false
+		}
+		if descend && root.isOtherDevice(info) {
+			slog.Debug("FileWalker: xdev", slog.String("path", path))
+			descend = false
+		}
+		if descend {
+			return visitDescend, entry
+		}
+		if w.dirs && depth >= w.minDepth {
+			WalkEntryCount.Incr()
+			if !send(entry, nil) {
+				return visitStop, nil
+			}
+		}
+		return visitNext, nil
+	}
+	if depth < w.minDepth {
+		return visitNext, nil
+	}
+
+	if w.isArchive(entry) {
+		WalkArchiveCount.Incr()
+		a := newArchiveWalker(w.exclude, w.archiveOpts...)
+		if err := a.walkArchive(ctx, archiveKindOf(info.Name()), path, send); err != nil {
+			if !w.fail(path, info, err, send) {
+				return visitStop, nil
+			}
+		}
+		return visitNext, nil
+	}
+	if c := compressionOf(info.Name()); w.decompress && c != CompressionNone {
+		WalkCompressedCount.Incr()
+		if !w.walkCompressed(c, path, info, dir, send) {
+			return visitStop, nil
+		}
+		return visitNext, nil
+	}
+
+	WalkEntryCount.Incr()
+	if !send(entry, nil) {
+		return visitStop, nil
+	}
+	return visitNext, nil
+}
+
+// walkCompressed sends the file in the compressed file path unless it is rejected.
+// Returns false if send returns false.
+func (w *FileWalker) walkCompressed(c Compression, path string, info fs.FileInfo, dir *dirContext, send func(Entry, error) bool) bool {
+	entry, err := newCompressedEntry(c, path, info)
+	if err != nil {
+		return w.fail(path, info, err, send)
+	}
+	if w.isRejected(entry, dir.localConfigs()) {
+		return true
+	}
+	WalkEntryCount.Incr()
+	return send(entry, nil)
+}
+
+func (w *FileWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
 	WalkCount.Incr()
-	w.err = nil
 	root = os.ExpandEnv(root)
 
-	return func(yield func(Entry) bool) {
-		resultC := make(chan Entry, walkerBufferSize)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		go func() {
-			defer close(resultC)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		r := w.newWalkRoot(root)
+		if w.parallel > 1 || w.followSymlinks || w.gitignore != GitignoreNone || w.localConfig || w.dirs || w.parent {
+			w.walkParallel(ctx, r, send)
+			return nil
+		}
 
-			w.err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
-				slog.Debug("FileWalker", slog.String("path", path), logx.Err(err))
-				WalkCallCount.Incr()
+		// the mounts are shared by the entries of the same directory
+		dirs := map[string]*dirContext{}
+		return filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			slog.Debug("FileWalker", slog.String("path", path), logx.Err(err))
+			WalkCallCount.Incr()
 
-				select {
-				case <-ctx.Done():
+			if syncx.Done(ctx) {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				// continue walking past the unreadable path
+				if !w.fail(path, info, err, send) {
 					return filepath.SkipAll
-				default:
-					if err != nil {
-						return err
-					}
-
-					entry := NewEntry(path, info, nil)
-					if w.isRejected(entry) {
-						if info.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil
-					}
-
-					if info.IsDir() {
-						WalkDirCount.Incr()
-						// skip dir
-						return nil
-					}
-
-					WalkEntryCount.Incr()
-					resultC <- entry
-					return nil
 				}
-			})
-		}()
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 
-		for x := range resultC {
-			if !yield(x) {
-				return
+			parent := filepath.Dir(path)
+			dir, ok := dirs[parent]
+			if !ok {
+				dir = &dirContext{mount: newDirMount(parent)}
+				dirs[parent] = dir
 			}
-		}
+			switch result, _ := w.visit(ctx, r, path, pathDepth(root, path), info, nil, dir, send); result {
+			case visitStop:
+				return filepath.SkipAll
+			case visitNext:
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			default:
+				return nil
+			}
+		})
+	})
+}
+
+// pathDepth returns the number of the path components of path relative to root.
+func pathDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
 	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
 }
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package walk
+
+import "io/fs"
+
+// fileID is not available on this platform.
+func fileID(_ fs.FileInfo) (string, bool) { return "", false }
+
+// fileDev is not available on this platform.
+func fileDev(_ fs.FileInfo) (uint64, bool) { return 0, false }
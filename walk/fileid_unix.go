@@ -0,0 +1,27 @@
+//go:build unix
+
+package walk
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and the inode of info.
+func fileID(info fs.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), true
+}
+
+// fileDev returns the device of info.
+func fileDev(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,279 @@
+package walk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/syncx"
+)
+
+var _ Walker = &GitWalker{}
+
+func NewGit(exclude expr.Expr, opt ...ArchiveOption) *GitWalker {
+	return &GitWalker{
+		archiveWalker: newArchiveWalker(exclude, opt...),
+	}
+}
+
+// GitWalker walks the files in the tree of the git repository at the revision by the git command,
+// without checking it out.
+//
+// The root is REPO@REV, e.g. /path/to/repo@v1.0, and REV is HEAD if omitted.
+// The paths of the files are under the root, not the working tree of the repository.
+type GitWalker struct {
+	archiveWalker
+}
+
+var (
+	ErrGit = errors.New("Git")
+)
+
+const (
+	gitRevSep     = "@"
+	gitDefaultRev = "HEAD"
+)
+
+// ParseGitRoot splits root into the repository and the revision.
+// The repository is the shortest prefix before "@" that is a directory, so the revision can contain "@", e.g. HEAD@{1}.
+func ParseGitRoot(root string) (repo, rev string) {
+	for i := 0; i < len(root); i++ {
+		j := strings.Index(root[i:], gitRevSep)
+		if j < 0 {
+			break
+		}
+		i += j
+		if info, err := os.Stat(root[:i]); err == nil && info.IsDir() {
+			return root[:i], root[i+len(gitRevSep):]
+		}
+	}
+	return root, gitDefaultRev
+}
+
+func (w *GitWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		return w.walkGit(ctx, root, send)
+	})
+}
+
+// runGit runs the git command in repo and returns the stdout.
+func runGit(ctx context.Context, repo string, arg ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, arg...)...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w: %s", ErrGit, strings.Join(arg, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return b, nil
+}
+
+func (w *GitWalker) walkGit(ctx context.Context, root string, send func(Entry, error) bool) error {
+	repo, rev := ParseGitRoot(root)
+	if rev == "" {
+		rev = gitDefaultRev
+	}
+	if strings.HasPrefix(rev, "-") {
+		// not to be an option
+		return fmt.Errorf("%w: invalid revision: %s", ErrGit, rev)
+	}
+	b, err := runGit(ctx, repo, "show", "--no-patch", "--format=%H %ct", "--end-of-options", rev+"^{commit}", "--")
+	if err != nil {
+		return err
+	}
+	commit, ts, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: commit time: %s", ErrGit, ts)
+	}
+	modTime := time.Unix(sec, 0)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "ls-tree", "-r", "-l", "-z", "--full-tree", commit)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %w", ErrGit, err)
+	}
+	walkErr := w.walkTree(ctx, stdout, root, repo, rev, commit, modTime, send)
+	// drain to finish the command
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil && !syncx.Done(ctx) {
+		return fmt.Errorf("%w: ls-tree: %w: %s", ErrGit, err, strings.TrimSpace(stderr.String()))
+	}
+	return walkErr
+}
+
+// walkTree sends the files of the output of ls-tree -r -l -z.
+func (w *GitWalker) walkTree(
+	ctx context.Context,
+	r io.Reader,
+	root, repo, rev, commit string,
+	modTime time.Time,
+	send func(Entry, error) bool,
+) error {
+	var (
+		br    = bufio.NewReader(r)
+		chain = []string{root}
+	)
+	for !syncx.Done(ctx) {
+		line, err := br.ReadString(0)
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		// <mode> SP <type> SP <object> SP <size> TAB <path>
+		header, relpath, ok := strings.Cut(strings.TrimSuffix(line, "\x00"), "\t")
+		fields := strings.Fields(header)
+		if !ok || len(fields) != 4 {
+			return fmt.Errorf("%w: bad ls-tree line: %q", ErrGit, line)
+		}
+		var (
+			mode   = fields[0]
+			typ    = fields[1]
+			object = fields[2]
+			size   int64
+		)
+		if fields[3] != "-" {
+			if size, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+				return fmt.Errorf("%w: bad size: %q", ErrGit, line)
+			}
+		}
+
+		p := filepath.Join(root, filepath.FromSlash(relpath))
+		slog.Debug("GitWalker", slog.String("root", root), slog.String("path", p))
+		WalkCallCount.Incr()
+		entry := NewEntry(
+			p,
+			&gitFileInfo{
+				name:    path.Base(relpath),
+				size:    size,
+				mode:    gitFileMode(mode),
+				modTime: modTime,
+			},
+			EntryAttrs{
+				Chain: chain,
+				Git: NewGitEntry(
+					repo,
+					rev,
+					commit,
+					relpath,
+					mode,
+					typ,
+					object,
+				),
+			},
+		)
+		if w.emit(entry, send) && typ == "blob" {
+			w.descend(ctx, entry, relpath, func() (io.ReadCloser, error) {
+				return openGitBlob(ctx, repo, object)
+			}, root, chain, send)
+		}
+	}
+	return nil
+}
+
+// gitFileMode converts the mode of the tree entry into fs.FileMode.
+func gitFileMode(mode string) fs.FileMode {
+	switch mode {
+	case "100755":
+		return 0o755
+	case "120000":
+		return fs.ModeSymlink | 0o777
+	case "160000":
+		// submodule
+		return fs.ModeIrregular
+	default:
+		return 0o644
+	}
+}
+
+var _ fs.FileInfo = &gitFileInfo{}
+
+// gitFileInfo is fs.FileInfo of the file in the tree.
+// The modification time is the commit time.
+type gitFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *gitFileInfo) Name() string       { return i.name }
+func (i *gitFileInfo) Size() int64        { return i.size }
+func (i *gitFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *gitFileInfo) ModTime() time.Time { return i.modTime }
+func (i *gitFileInfo) IsDir() bool        { return false }
+func (i *gitFileInfo) Sys() any           { return nil }
+
+// gitObjectRegexp matches the object id, sha1 or sha256.
+var gitObjectRegexp = regexp.MustCompile(`^[0-9a-f]{40}(?:[0-9a-f]{24})?$`)
+
+// openGitBlob returns the content of the blob by git cat-file.
+func openGitBlob(ctx context.Context, repo, object string) (io.ReadCloser, error) {
+	if !gitObjectRegexp.MatchString(object) {
+		return nil, fmt.Errorf("%w: invalid object: %s", ErrGit, object)
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "cat-file", "blob", "--end-of-options", object)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGit, err)
+	}
+	return &gitBlobReader{
+		ReadCloser: stdout,
+		cmd:        cmd,
+		stderr:     &stderr,
+	}, nil
+}
+
+type gitBlobReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *gitBlobReader) Close() error {
+	_, _ = io.Copy(io.Discard, r.ReadCloser)
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: cat-file: %w: %s", ErrGit, err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// OpenGitBlob opens the content of the file in the git repository.
+// ok is false if the entry is not a blob in the git repository.
+func OpenGitBlob(ctx context.Context, entry Entry) (rc io.ReadCloser, ok bool, err error) {
+	g := entry.Git()
+	if g == nil || g.ObjectType() != "blob" {
+		return nil, false, nil
+	}
+	rc, err = openGitBlob(ctx, g.Repo(), g.Object())
+	return rc, true, err
+}
@@ -0,0 +1,49 @@
+// Code generated by "dataclass -type GitEntry -field Repo string|Revision string|Commit string|RelPath string|Mode string|ObjectType string|Object string -output gitentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type GitEntry interface {
+	Repo() string
+	Revision() string
+	Commit() string
+	RelPath() string
+	Mode() string
+	ObjectType() string
+	Object() string
+}
+type gitEntry struct {
+	repo       string
+	revision   string
+	commit     string
+	relPath    string
+	mode       string
+	objectType string
+	object     string
+}
+
+func (s *gitEntry) Repo() string       { return s.repo }
+func (s *gitEntry) Revision() string   { return s.revision }
+func (s *gitEntry) Commit() string     { return s.commit }
+func (s *gitEntry) RelPath() string    { return s.relPath }
+func (s *gitEntry) Mode() string       { return s.mode }
+func (s *gitEntry) ObjectType() string { return s.objectType }
+func (s *gitEntry) Object() string     { return s.object }
+func NewGitEntry(
+	repo string,
+	revision string,
+	commit string,
+	relPath string,
+	mode string,
+	objectType string,
+	object string,
+) GitEntry {
+	return &gitEntry{
+		repo:       repo,
+		revision:   revision,
+		commit:     commit,
+		relPath:    relPath,
+		mode:       mode,
+		objectType: objectType,
+		object:     object,
+	}
+}
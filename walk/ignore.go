@@ -0,0 +1,208 @@
+package walk
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/berquerant/metafind/logx"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// Gitignore is the way to treat the files ignored by the gitignore files.
+type Gitignore string
+
+const (
+	// GitignoreNone disables the gitignore files.
+	GitignoreNone Gitignore = ""
+	// GitignorePrune skips the ignored files and directories.
+	GitignorePrune Gitignore = "prune"
+	// GitignoreMark yields the ignored files with the matched rules.
+	GitignoreMark Gitignore = "mark"
+)
+
+var (
+	ErrUnknownGitignore = errors.New("UnknownGitignore")
+)
+
+func ParseGitignore(s string) (Gitignore, error) {
+	switch g := Gitignore(s); g {
+	case GitignoreNone, GitignorePrune, GitignoreMark:
+		return g, nil
+	default:
+		return GitignoreNone, fmt.Errorf("%w: %s", ErrUnknownGitignore, s)
+	}
+}
+
+// ignoreFiles are the files of the ignore rules in each directory, in ascending order of priority.
+var ignoreFiles = []string{
+	".gitignore",
+	".ignore",
+}
+
+// gitDirName is the name of the git directory, that is not walked with the ignore rules.
+const gitDirName = ".git"
+
+// findGitRepository returns the root of the git repository containing dir,
+// and the components of dir relative to the repository root.
+func findGitRepository(dir string) (string, []string, bool) {
+	p, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, false
+	}
+	var components []string
+	for {
+		if _, err := os.Lstat(filepath.Join(p, gitDirName)); err == nil {
+			slices.Reverse(components)
+			return p, components, true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", nil, false
+		}
+		components = append(components, filepath.Base(p))
+		p = parent
+	}
+}
+
+// gitDir returns the git directory of the repository root repo.
+// .git may be a file like "gitdir: PATH" for the worktrees and the submodules.
+func gitDir(repo string) string {
+	p := filepath.Join(repo, gitDirName)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		// directory
+		return p
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !ok {
+		return p
+	}
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repo, dir)
+	}
+	return dir
+}
+
+type ignoreRule struct {
+	pattern gitignore.Pattern
+	rule    string
+	source  string
+}
+
+// ignoreList is the ignore rules applied to the entries of a directory.
+type ignoreList struct {
+	rules []ignoreRule
+	// components of the directory relative to the root
+	components []string
+	// ignored is not nil if the directory is ignored, then its descendants are also ignored
+	ignored IgnoreEntry
+}
+
+// newIgnoreList returns the ignore rules of the root directory.
+// If the root is in a git repository, the rules of info/exclude of the repository
+// and the ignore files of the directories from the repository root to the root apply.
+func newIgnoreList(root string) *ignoreList {
+	x := &ignoreList{}
+	repo, components, ok := findGitRepository(root)
+	if !ok {
+		x.load(root)
+		return x
+	}
+	x.loadFile(filepath.Join(gitDir(repo), "info", "exclude"))
+	x.load(repo)
+	dir := repo
+	for _, name := range components {
+		dir = filepath.Join(dir, name)
+		x = x.enter(dir, name, x.match(name, true))
+	}
+	return x
+}
+
+// load reads the ignore files of the directory.
+func (l *ignoreList) load(dir string) {
+	for _, name := range ignoreFiles {
+		l.loadFile(filepath.Join(dir, name))
+	}
+}
+
+func (l *ignoreList) loadFile(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Debug("FileWalker: ignore", slog.String("path", path), logx.Err(err))
+		}
+		return
+	}
+	defer f.Close()
+	var (
+		scanner = bufio.NewScanner(f)
+		line    int
+	)
+	l.rules = slices.Clip(l.rules)
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(s, "#") || strings.TrimSpace(s) == "" {
+			continue
+		}
+		l.rules = append(l.rules, ignoreRule{
+			pattern: gitignore.ParsePattern(s, l.components),
+			rule:    s,
+			source:  fmt.Sprintf("%s:%d", path, line),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Debug("FileWalker: ignore", slog.String("path", path), logx.Err(err))
+	}
+}
+
+// skip returns true if the entry name of the directory should not be walked, that is, the git directory.
+func (l *ignoreList) skip(name string) bool {
+	return l != nil && name == gitDirName
+}
+
+// match returns the last rule matching the entry name of the directory.
+// Returns nil if the rules are disabled.
+func (l *ignoreList) match(name string, isDir bool) IgnoreEntry {
+	if l == nil {
+		return nil
+	}
+	if l.ignored != nil {
+		return l.ignored
+	}
+	path := append(slices.Clip(l.components), name)
+	for i := len(l.rules) - 1; i >= 0; i-- {
+		r := l.rules[i]
+		switch r.pattern.Match(path, isDir) {
+		case gitignore.Exclude:
+			return NewIgnoreEntry(true, r.rule, r.source)
+		case gitignore.Include:
+			return NewIgnoreEntry(false, r.rule, r.source)
+		}
+	}
+	return NewIgnoreEntry(false, "", "")
+}
+
+// enter returns the ignore rules of the subdirectory dir, whose name is name and matched by m.
+func (l *ignoreList) enter(dir, name string, m IgnoreEntry) *ignoreList {
+	if l == nil {
+		return nil
+	}
+	x := &ignoreList{
+		rules:      l.rules,
+		components: append(slices.Clip(l.components), name),
+	}
+	if l.ignored != nil || (m != nil && m.Ignored()) {
+		x.ignored = m
+		return x
+	}
+	x.load(dir)
+	return x
+}
@@ -0,0 +1,29 @@
+// Code generated by "dataclass -type IgnoreEntry -field Ignored bool|Rule string|Source string -output ignoreentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type IgnoreEntry interface {
+	Ignored() bool
+	Rule() string
+	Source() string
+}
+type ignoreEntry struct {
+	ignored bool
+	rule    string
+	source  string
+}
+
+func (s *ignoreEntry) Ignored() bool  { return s.ignored }
+func (s *ignoreEntry) Rule() string   { return s.rule }
+func (s *ignoreEntry) Source() string { return s.source }
+func NewIgnoreEntry(
+	ignored bool,
+	rule string,
+	source string,
+) IgnoreEntry {
+	return &ignoreEntry{
+		ignored: ignored,
+		rule:    rule,
+		source:  source,
+	}
+}
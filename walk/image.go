@@ -0,0 +1,663 @@
+package walk
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/syncx"
+)
+
+var _ Walker = &ImageWalker{}
+
+func NewImage(exclude expr.Expr, opt ...ArchiveOption) *ImageWalker {
+	return &ImageWalker{
+		archiveWalker: newArchiveWalker(exclude, opt...),
+	}
+}
+
+// ImageWalker walks the files in the container images of OCI image layout directory or docker save tarball.
+//
+// The layers are applied in order with the whiteout files, and the files of all the layers are yielded.
+// The files overwritten or deleted by the later layers are marked as shadowed,
+// so the files not shadowed are the final file system of the image.
+// The images in the index are walked one by one, including all the platforms.
+type ImageWalker struct {
+	archiveWalker
+}
+
+var (
+	ErrImage = errors.New("Image")
+)
+
+func (w *ImageWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		src, err := newImageSource(root)
+		if err != nil {
+			return err
+		}
+		images, err := src.images()
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			if syncx.Done(ctx) {
+				return nil
+			}
+			if err := w.walkImage(ctx, src, root, image, send); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrImage, image.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// imageFile is a file in a layer.
+type imageFile struct {
+	name   string
+	header *tar.Header
+	layer  int
+	// shadowedBy is the index of the layer overwriting or deleting the file, or -1
+	shadowedBy int
+}
+
+// imageTree is the tree of the files by the components of the names.
+type imageTree struct {
+	// file is nil if no files of the name are visible
+	file     *imageFile
+	children map[string]*imageTree
+}
+
+// node returns the node of name; the root if name is empty.
+// Returns nil if not found and create is false.
+func (t *imageTree) node(name string, create bool) *imageTree {
+	if name == "" {
+		return t
+	}
+	n := t
+	for _, x := range strings.Split(name, "/") {
+		c, ok := n.children[x]
+		if !ok {
+			if !create {
+				return nil
+			}
+			if n.children == nil {
+				n.children = map[string]*imageTree{}
+			}
+			c = &imageTree{}
+			n.children[x] = c
+		}
+		n = c
+	}
+	return n
+}
+
+// removeUnder removes the nodes under the node, calling f for their files.
+func (t *imageTree) removeUnder(f func(*imageFile)) {
+	for _, c := range t.children {
+		if c.file != nil {
+			f(c.file)
+		}
+		c.removeUnder(f)
+	}
+	t.children = nil
+}
+
+// imageFS is the file system of the image built by applying the layers.
+type imageFS struct {
+	// files are the files of all the layers in order
+	files []*imageFile
+	// visible are the files not shadowed
+	visible imageTree
+}
+
+func newImageFS() *imageFS {
+	return &imageFS{}
+}
+
+// shadow shadows the file name, and the files under it if it is a directory.
+// subtree forces to shadow the files under name, for the directories without their own headers.
+func (s *imageFS) shadow(name string, layer int, subtree bool) {
+	n := s.visible.node(name, false)
+	if n == nil {
+		return
+	}
+	if f := n.file; f != nil {
+		f.shadowedBy = layer
+		n.file = nil
+		subtree = subtree || f.header.Typeflag == tar.TypeDir
+	}
+	if subtree {
+		n.removeUnder(func(f *imageFile) { f.shadowedBy = layer })
+	}
+}
+
+// shadowUnder shadows the files under the directory dir; the root if dir is empty.
+func (s *imageFS) shadowUnder(dir string, layer int) {
+	if n := s.visible.node(dir, false); n != nil {
+		n.removeUnder(func(f *imageFile) { f.shadowedBy = layer })
+	}
+}
+
+// apply adds the files of the layer.
+// The whiteout files delete the files of the lower layers, not of the same layer.
+func (s *imageFS) apply(r io.Reader, layer int) error {
+	reader := tar.NewReader(r)
+	var (
+		files     []*imageFile
+		whiteouts []string
+		opaques   []string
+	)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if name == "" {
+			// root
+			continue
+		}
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == whiteoutOpaque:
+			opaques = append(opaques, dir)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		default:
+			files = append(files, &imageFile{
+				name:       name,
+				header:     header,
+				layer:      layer,
+				shadowedBy: -1,
+			})
+		}
+	}
+
+	for _, dir := range opaques {
+		s.shadowUnder(dir, layer)
+	}
+	for _, name := range whiteouts {
+		s.shadow(name, layer, true)
+	}
+	for _, f := range files {
+		n := s.visible.node(f.name, true)
+		if old := n.file; old != nil {
+			if old.header.Typeflag == tar.TypeDir && f.header.Typeflag == tar.TypeDir {
+				// merged
+				old.shadowedBy = layer
+				n.file = nil
+			} else {
+				s.shadow(f.name, layer, false)
+			}
+		}
+		n.file = f
+		s.files = append(s.files, f)
+	}
+	return nil
+}
+
+func (w *ImageWalker) walkImage(ctx context.Context, src imageSource, root string, image *imageSpec, send func(Entry, error) bool) error {
+	fsys := newImageFS()
+	for i, layer := range image.layers {
+		if syncx.Done(ctx) {
+			return nil
+		}
+		slog.Debug("ImageWalker: layer", slog.String("root", root), slog.String("image", image.name), slog.String("path", layer.path))
+		if err := w.applyLayer(src, fsys, layer, i); err != nil {
+			return fmt.Errorf("layer %s: %w", layer.path, err)
+		}
+	}
+
+	chain := []string{root}
+	for _, f := range fsys.files {
+		p := filepath.Join(root, filepath.FromSlash(f.name))
+		WalkCallCount.Incr()
+		if syncx.Done(ctx) {
+			return nil
+		}
+		var shadowedBy string
+		if f.shadowedBy >= 0 {
+			shadowedBy = image.layers[f.shadowedBy].digest
+		}
+		entry := NewEntry(
+			p,
+			f.header.FileInfo(),
+			EntryAttrs{
+				Tar: NewTarEntry(
+					root,
+					f.name,
+					string(f.header.Typeflag),
+					f.header.Uid,
+					f.header.Gid,
+					f.header.Uname,
+					f.header.Gname,
+					f.header.Linkname,
+					f.header.PAXRecords,
+				),
+				Chain: chain,
+				Layer: NewLayerEntry(
+					image.name,
+					image.platform,
+					image.layers[f.layer].digest,
+					f.layer,
+					f.shadowedBy >= 0,
+					shadowedBy,
+				),
+			},
+		)
+		w.emit(entry, send)
+	}
+	return nil
+}
+
+// applyLayer applies the layer to fsys.
+// The digest of the layer is computed if unknown.
+func (w *ImageWalker) applyLayer(src imageSource, fsys *imageFS, layer *imageLayer, index int) error {
+	rc, err := src.open(layer.path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var (
+		r io.Reader = rc
+		h hash.Hash
+	)
+	if layer.digest == "" {
+		h = sha256.New()
+		r = io.TeeReader(rc, h)
+	}
+	dr, closer, err := newDecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	if err := fsys.apply(dr, index); err != nil {
+		return err
+	}
+	if h != nil {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		layer.digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
+}
+
+// imageSpec is an image to walk.
+type imageSpec struct {
+	// name is the reference of the image, or the digest of the manifest if unknown
+	name     string
+	platform string
+	layers   []*imageLayer
+}
+
+type imageLayer struct {
+	// path is the path of the layer in the image source
+	path string
+	// digest is empty if the layer is not content addressed
+	digest string
+}
+
+// imageSource reads the files of OCI image layout or docker save tarball.
+type imageSource interface {
+	open(name string) (io.ReadCloser, error)
+	images() ([]*imageSpec, error)
+}
+
+func newImageSource(root string) (imageSource, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	var src imageFiles
+	if info.IsDir() {
+		src = &dirImageFiles{root: root}
+	} else {
+		src = &tarImageFiles{root: root}
+	}
+	return &imageLayout{imageFiles: src}, nil
+}
+
+type imageFiles interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+// validImagePath returns an error if name is not a relative path staying in the image source,
+// e.g. "../x" in the manifest.
+func validImagePath(name string) error {
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("%w: invalid path: %s", ErrImage, name)
+	}
+	return nil
+}
+
+// dirImageFiles reads the files of the directory.
+type dirImageFiles struct {
+	root string
+}
+
+func (s *dirImageFiles) open(name string) (io.ReadCloser, error) {
+	if err := validImagePath(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(s.root, filepath.FromSlash(name)))
+}
+
+// tarImageFiles reads the files in the tarball.
+type tarImageFiles struct {
+	root string
+	// index is the files in the tarball by the cleaned names, built by the first open
+	index map[string]*tarImageEntry
+}
+
+// tarImageEntry is a file in the tarball.
+type tarImageEntry struct {
+	header *tar.Header
+	// offset is the offset of the content in the tarball
+	offset int64
+}
+
+const maxImageLinks = 8
+
+// open opens the file name in the tarball, following the links.
+func (s *tarImageFiles) open(name string) (io.ReadCloser, error) {
+	if s.index == nil {
+		if err := s.buildIndex(); err != nil {
+			return nil, err
+		}
+	}
+	for range maxImageLinks {
+		if err := validImagePath(name); err != nil {
+			return nil, err
+		}
+		x, ok := s.index[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s in %s", fs.ErrNotExist, name, s.root)
+		}
+		switch x.header.Typeflag {
+		case tar.TypeSymlink:
+			name = path.Join(path.Dir(name), x.header.Linkname)
+		case tar.TypeLink:
+			name = path.Clean(x.header.Linkname)
+		default:
+			f, err := os.Open(s.root)
+			if err != nil {
+				return nil, err
+			}
+			return &tarImageFile{
+				Reader: io.NewSectionReader(f, x.offset, x.header.Size),
+				file:   f,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: too many links: %s", ErrImage, name)
+}
+
+// buildIndex scans the tarball once to find the offsets of the files.
+func (s *tarImageFiles) buildIndex() error {
+	f, err := os.Open(s.root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	index := map[string]*tarImageEntry{}
+	// tar.Reader does not read ahead and skips the contents by Seek,
+	// so the offset of the file is the position after the header
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		index[path.Clean(header.Name)] = &tarImageEntry{
+			header: header,
+			offset: offset,
+		}
+	}
+	s.index = index
+	return nil
+}
+
+type tarImageFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *tarImageFile) Close() error { return f.file.Close() }
+
+// imageLayout reads the images by manifest.json of docker save, or index.json of OCI image layout.
+type imageLayout struct {
+	imageFiles
+}
+
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant"`
+}
+
+func (p *ociPlatform) String() string {
+	if p == nil {
+		return ""
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Platform    *ociPlatform      `json:"platform"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ociManifest is an image index or an image manifest.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+func (s *imageLayout) readJSON(name string, v any) error {
+	rc, err := s.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrImage, name, err)
+	}
+	return nil
+}
+
+func (s *imageLayout) images() ([]*imageSpec, error) {
+	var manifests []dockerManifest
+	switch err := s.readJSON("manifest.json", &manifests); {
+	case err == nil:
+		return s.dockerImages(manifests), nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	var index ociManifest
+	if err := s.readJSON("index.json", &index); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: neither manifest.json nor index.json: %w", ErrImage, err)
+		}
+		return nil, err
+	}
+	var images []*imageSpec
+	for _, x := range index.Manifests {
+		xs, err := s.ociImages(x, imageRefName(x), 0)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, xs...)
+	}
+	return images, nil
+}
+
+func (s *imageLayout) dockerImages(manifests []dockerManifest) []*imageSpec {
+	images := make([]*imageSpec, len(manifests))
+	for i, m := range manifests {
+		name := m.Config
+		if len(m.RepoTags) > 0 {
+			name = m.RepoTags[0]
+		}
+		layers := make([]*imageLayer, len(m.Layers))
+		for j, x := range m.Layers {
+			layers[j] = &imageLayer{
+				path:   x,
+				digest: blobDigest(x),
+			}
+		}
+		images[i] = &imageSpec{
+			name:   name,
+			layers: layers,
+		}
+	}
+	return images
+}
+
+const maxImageIndexDepth = 8
+
+// ociImages returns the images of the manifest or the index of the descriptor.
+func (s *imageLayout) ociImages(desc ociDescriptor, name string, depth int) ([]*imageSpec, error) {
+	if depth > maxImageIndexDepth {
+		return nil, fmt.Errorf("%w: too deep index: %s", ErrImage, desc.Digest)
+	}
+	p, err := blobPath(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var m ociManifest
+	if err := s.readJSON(p, &m); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = desc.Digest
+	}
+
+	if len(m.Manifests) > 0 {
+		// index
+		var images []*imageSpec
+		for _, x := range m.Manifests {
+			xName := imageRefName(x)
+			if xName == "" {
+				xName = name
+			}
+			xs, err := s.ociImages(x, xName, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, xs...)
+		}
+		return images, nil
+	}
+
+	image := &imageSpec{
+		name:     name,
+		platform: desc.Platform.String(),
+	}
+	for _, x := range m.Layers {
+		if x.MediaType != "" && !strings.Contains(x.MediaType, "tar") {
+			// not a file system layer, e.g. attestation
+			slog.Debug("ImageWalker: skip layer", slog.String("digest", x.Digest), slog.String("mediaType", x.MediaType))
+			continue
+		}
+		p, err := blobPath(x.Digest)
+		if err != nil {
+			return nil, err
+		}
+		image.layers = append(image.layers, &imageLayer{
+			path:   p,
+			digest: x.Digest,
+		})
+	}
+	if len(image.layers) == 0 {
+		slog.Warn("ImageWalker: no layers", slog.String("image", name))
+	}
+	return []*imageSpec{image}, nil
+}
+
+func imageRefName(desc ociDescriptor) string {
+	for _, key := range []string{
+		"io.containerd.image.name",
+		"org.opencontainers.image.ref.name",
+	} {
+		if x := desc.Annotations[key]; x != "" {
+			return x
+		}
+	}
+	return ""
+}
+
+var (
+	// digestAlgorithmRegexp is the algorithm of the digest by the OCI image spec.
+	digestAlgorithmRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*$`)
+	// digestEncodedRegexp is the hex encoded part of the digest.
+	digestEncodedRegexp = regexp.MustCompile(`^[a-f0-9]+$`)
+)
+
+// blobPath returns the path of the blob of the digest in OCI image layout, e.g. blobs/sha256/HEX.
+func blobPath(digest string) (string, error) {
+	alg, encoded, _ := strings.Cut(digest, ":")
+	if !digestAlgorithmRegexp.MatchString(alg) || !digestEncodedRegexp.MatchString(encoded) {
+		return "", fmt.Errorf("%w: invalid digest: %q", ErrImage, digest)
+	}
+	return path.Join("blobs", alg, encoded), nil
+}
+
+// blobDigest returns the digest of the blob path, or empty if path is not a blob.
+func blobDigest(name string) string {
+	dir, encoded := path.Split(path.Clean(name))
+	dir = strings.TrimSuffix(dir, "/")
+	if path.Dir(dir) != "blobs" || encoded == "" {
+		return ""
+	}
+	return path.Base(dir) + ":" + encoded
+}
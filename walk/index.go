@@ -0,0 +1,72 @@
+package walk
+
+import (
+	"context"
+	"iter"
+	"log/slog"
+	"os"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/meta"
+)
+
+var _ Walker = &IndexWalker{}
+
+func NewIndex(exclude expr.Expr) *IndexWalker {
+	return &IndexWalker{
+		exclude: exclude,
+	}
+}
+
+// IndexWalker reads metadata from the index file (jsonl) instead of scanning the directory.
+type IndexWalker struct {
+	exclude expr.Expr
+}
+
+func (w *IndexWalker) isRejected(data *meta.Data) bool {
+	if w.exclude == nil {
+		return false
+	}
+	rejected, err := w.exclude.Run(data.Unwrap())
+	if err != nil {
+		WalkExcludeErrCount.Incr()
+		slog.Warn("IndexWalker: exclude", logx.JSON("data", data), logx.Err(err))
+		return true
+	}
+	if rejected {
+		WalkExcludeCount.Incr()
+	}
+	return rejected
+}
+
+func (w *IndexWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		f, err := os.Open(root)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		reader := meta.NewReader(f)
+		for data := range reader.Read(ctx) {
+			WalkCallCount.Incr()
+			x, _ := data.Get("path")
+			path, ok := x.(string)
+			if !ok {
+				slog.Warn("IndexWalker: no path", slog.String("root", root))
+				continue
+			}
+			if w.isRejected(data) {
+				continue
+			}
+			WalkEntryCount.Incr()
+			if !send(NewEntry(path, nil, EntryAttrs{Meta: data}), nil) {
+				break
+			}
+		}
+		return reader.Err()
+	})
+}
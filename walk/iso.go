@@ -0,0 +1,682 @@
+package walk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/syncx"
+)
+
+var _ Walker = &ISOWalker{}
+
+func NewISO(exclude expr.Expr, opt ...ArchiveOption) *ISOWalker {
+	return &ISOWalker{
+		archiveWalker: newArchiveWalker(exclude, opt...),
+	}
+}
+
+// ISOWalker walks files in ISO9660 disk image.
+// The names and the attributes of Rock Ridge are preferred, and then the names of Joliet.
+type ISOWalker struct {
+	archiveWalker
+}
+
+func (w *ISOWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		return w.walkArchive(ctx, archiveISO, root, send)
+	})
+}
+
+// ISOExtension is the extension of ISO9660 providing the names.
+type ISOExtension string
+
+const (
+	ISOExtensionNone      ISOExtension = ""
+	ISOExtensionRockRidge ISOExtension = "rockridge"
+	ISOExtensionJoliet    ISOExtension = "joliet"
+)
+
+const (
+	isoSectorSize        = 2048
+	isoDescriptorStart   = 16
+	isoMaxDescriptors    = 64
+	isoMaxContinuations  = 16
+	isoMaxDirSize        = 64 << 20
+	isoRecordMinSize     = 33
+	isoFlagDir           = 0x02
+	isoFlagMultiExtent   = 0x80
+	isoDescriptorPrimary = 1
+	isoDescriptorSupp    = 2
+	isoDescriptorEnd     = 255
+)
+
+var isoIdentifier = []byte("CD001")
+
+// isoVolume is the volume of ISO9660 to read the directories of.
+type isoVolume struct {
+	r         io.ReaderAt
+	blockSize int64
+	root      *isoRecord
+	extension ISOExtension
+	// suspSkip is the number of bytes to skip in the system use area of Rock Ridge
+	suspSkip int
+}
+
+// isoExtent is a part of the data of the file.
+type isoExtent struct {
+	offset int64
+	size   int64
+}
+
+// isoRecord is a directory record.
+type isoRecord struct {
+	name     string
+	extents  []isoExtent
+	size     int64
+	recorded time.Time
+	dir      bool
+	// rr is nil if the record has no Rock Ridge entries
+	rr *isoRockRidge
+}
+
+// isoRockRidge is the Rock Ridge entries of the record.
+type isoRockRidge struct {
+	name       string
+	mode       fs.FileMode
+	hasMode    bool
+	nlink      int
+	uid        int
+	gid        int
+	linkname   string
+	modTime    time.Time
+	accessTime time.Time
+	changeTime time.Time
+	createTime time.Time
+	// childLink is the location of the relocated directory, or -1
+	childLink int64
+	relocated bool
+}
+
+func (r *isoRecord) Name() string {
+	if r.rr != nil && r.rr.name != "" {
+		return r.rr.name
+	}
+	return r.name
+}
+
+func (r *isoRecord) FileInfo() fs.FileInfo { return &isoFileInfo{r: r} }
+
+// open returns the reader of the data of the file.
+func (r *isoRecord) open(ra io.ReaderAt) io.Reader {
+	rs := make([]io.Reader, len(r.extents))
+	for i, x := range r.extents {
+		rs[i] = io.NewSectionReader(ra, x.offset, x.size)
+	}
+	return io.MultiReader(rs...)
+}
+
+var _ fs.FileInfo = &isoFileInfo{}
+
+type isoFileInfo struct {
+	r *isoRecord
+}
+
+func (i *isoFileInfo) Name() string { return i.r.Name() }
+func (i *isoFileInfo) Size() int64  { return i.r.size }
+func (i *isoFileInfo) Mode() fs.FileMode {
+	if i.r.rr != nil && i.r.rr.hasMode {
+		return i.r.rr.mode
+	}
+	if i.r.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+func (i *isoFileInfo) ModTime() time.Time {
+	if i.r.rr != nil && !i.r.rr.modTime.IsZero() {
+		return i.r.rr.modTime
+	}
+	return i.r.recorded
+}
+func (i *isoFileInfo) IsDir() bool { return i.r.dir }
+func (i *isoFileInfo) Sys() any    { return i.r }
+
+// newISOVolume reads the volume descriptors.
+func newISOVolume(r io.ReaderAt) (*isoVolume, error) {
+	var (
+		primary []byte
+		joliet  []byte
+	)
+	for i := range isoMaxDescriptors {
+		b := make([]byte, isoSectorSize)
+		if _, err := r.ReadAt(b, int64(isoDescriptorStart+i)*isoSectorSize); err != nil {
+			return nil, fmt.Errorf("%w: iso: %w", ErrArchive, err)
+		}
+		if !bytes.Equal(b[1:6], isoIdentifier) {
+			return nil, fmt.Errorf("%w: iso: bad volume descriptor", ErrArchive)
+		}
+		switch b[0] {
+		case isoDescriptorPrimary:
+			if primary == nil {
+				primary = b
+			}
+		case isoDescriptorSupp:
+			// escape sequences of UCS-2 level 1, 2 and 3
+			if esc := b[88:91]; joliet == nil && esc[0] == '%' && esc[1] == '/' && bytes.IndexByte([]byte("@CE"), esc[2]) >= 0 {
+				joliet = b
+			}
+		}
+		if b[0] == isoDescriptorEnd {
+			break
+		}
+	}
+	if primary == nil {
+		return nil, fmt.Errorf("%w: iso: no primary volume descriptor", ErrArchive)
+	}
+
+	v := &isoVolume{
+		r:         r,
+		blockSize: int64(binary.LittleEndian.Uint16(primary[128:130])),
+	}
+	if v.blockSize == 0 {
+		v.blockSize = isoSectorSize
+	}
+	root, err := v.parseRecord(primary[156:190])
+	if err != nil {
+		return nil, err
+	}
+	v.root = root
+	if v.detectRockRidge() {
+		v.extension = ISOExtensionRockRidge
+		return v, nil
+	}
+	if joliet != nil {
+		v.extension = ISOExtensionJoliet
+		if v.root, err = v.parseRecord(joliet[156:190]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// detectRockRidge returns true if the first record of the root directory has SP entry of SUSP.
+func (v *isoVolume) detectRockRidge() bool {
+	b := make([]byte, isoSectorSize)
+	if _, err := v.r.ReadAt(b, v.root.extents[0].offset); err != nil {
+		return false
+	}
+	n := int(b[0])
+	if n < isoRecordMinSize+1 || n > len(b) {
+		return false
+	}
+	su := isoSystemUse(b[:n])
+	if len(su) < 7 || string(su[0:2]) != "SP" || su[4] != 0xbe || su[5] != 0xef {
+		return false
+	}
+	v.suspSkip = int(su[6])
+	return true
+}
+
+// isoSystemUse returns the system use area of the record.
+func isoSystemUse(b []byte) []byte {
+	nameLen := int(b[32])
+	start := isoRecordMinSize + nameLen
+	if nameLen%2 == 0 {
+		// padding
+		start++
+	}
+	if start > len(b) {
+		return nil
+	}
+	return b[start:]
+}
+
+func (v *isoVolume) parseRecord(b []byte) (*isoRecord, error) {
+	if len(b) < isoRecordMinSize || int(b[0]) > len(b) || int(b[32])+isoRecordMinSize > int(b[0]) {
+		return nil, fmt.Errorf("%w: iso: bad directory record", ErrArchive)
+	}
+	var (
+		extent = int64(binary.LittleEndian.Uint32(b[2:6]))
+		size   = int64(binary.LittleEndian.Uint32(b[10:14]))
+		flags  = b[25]
+		raw    = b[33 : 33+int(b[32])]
+		r      = &isoRecord{
+			extents: []isoExtent{{
+				offset: (extent + int64(b[1])) * v.blockSize,
+				size:   size,
+			}},
+			size:     size,
+			recorded: parseISOTime7(b[18:25]),
+			dir:      flags&isoFlagDir != 0,
+		}
+	)
+	switch {
+	case len(raw) == 1 && raw[0] == 0:
+		r.name = "."
+	case len(raw) == 1 && raw[0] == 1:
+		r.name = ".."
+	case v.extension == ISOExtensionJoliet:
+		u := make([]uint16, len(raw)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(raw[2*i:])
+		}
+		r.name = trimISOName(string(utf16.Decode(u)))
+	default:
+		r.name = trimISOName(string(raw))
+	}
+	if v.extension == ISOExtensionRockRidge {
+		rr, err := v.parseRockRidge(isoSystemUse(b[:b[0]]))
+		if err != nil {
+			return nil, err
+		}
+		r.rr = rr
+	}
+	return r, nil
+}
+
+// trimISOName removes the version and the trailing dot of the name, e.g. "FILE.TXT;1" is "FILE.TXT".
+func trimISOName(name string) string {
+	if i := strings.LastIndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	if x := strings.TrimSuffix(name, "."); x != "" {
+		return x
+	}
+	return name
+}
+
+// parseRockRidge parses the system use entries, following the continuation areas.
+func (v *isoVolume) parseRockRidge(su []byte) (*isoRockRidge, error) {
+	if len(su) < v.suspSkip {
+		return nil, nil
+	}
+	su = su[v.suspSkip:]
+	var (
+		rr = &isoRockRidge{
+			childLink: -1,
+		}
+		found    bool
+		linkCont bool
+	)
+	for range isoMaxContinuations {
+		var next []byte
+		for len(su) >= 4 {
+			sig, n := string(su[0:2]), int(su[2])
+			if n < 4 || n > len(su) {
+				break
+			}
+			data := su[4:n]
+			su = su[n:]
+			switch sig {
+			case "ST":
+				// terminator
+				su = nil
+			case "CE":
+				if len(data) < 24 {
+					continue
+				}
+				var (
+					block  = int64(binary.LittleEndian.Uint32(data[0:4]))
+					offset = int64(binary.LittleEndian.Uint32(data[8:12]))
+					length = int64(binary.LittleEndian.Uint32(data[16:20]))
+				)
+				if length > v.blockSize {
+					return nil, fmt.Errorf("%w: iso: bad continuation: %d", ErrArchive, length)
+				}
+				next = make([]byte, length)
+				if _, err := v.r.ReadAt(next, block*v.blockSize+offset); err != nil {
+					return nil, fmt.Errorf("%w: iso: continuation: %w", ErrArchive, err)
+				}
+			case "NM":
+				found = true
+				// skip the current and the parent
+				if len(data) >= 1 && data[0]&0x06 == 0 {
+					rr.name += string(data[1:])
+				}
+			case "PX":
+				found = true
+				if len(data) < 32 {
+					continue
+				}
+				rr.mode = posixFileMode(binary.LittleEndian.Uint32(data[0:4]))
+				rr.hasMode = true
+				rr.nlink = int(binary.LittleEndian.Uint32(data[8:12]))
+				rr.uid = int(binary.LittleEndian.Uint32(data[16:20]))
+				rr.gid = int(binary.LittleEndian.Uint32(data[24:28]))
+			case "TF":
+				found = true
+				parseISOTimestamps(rr, data)
+			case "SL":
+				found = true
+				if len(data) < 1 {
+					continue
+				}
+				rr.linkname, linkCont = appendISOSymlink(rr.linkname, linkCont, data[1:])
+			case "CL":
+				found = true
+				if len(data) >= 4 {
+					rr.childLink = int64(binary.LittleEndian.Uint32(data[0:4]))
+				}
+			case "RE":
+				found = true
+				rr.relocated = true
+			}
+		}
+		if next == nil {
+			break
+		}
+		su = next
+	}
+	if !found {
+		return nil, nil
+	}
+	return rr, nil
+}
+
+// appendISOSymlink appends the components of SL entry to link.
+// cont is true if the last component continues in the next component.
+func appendISOSymlink(link string, cont bool, b []byte) (string, bool) {
+	for len(b) >= 2 {
+		flags, n := b[0], int(b[1])
+		if 2+n > len(b) {
+			break
+		}
+		var component string
+		switch {
+		case flags&0x02 != 0:
+			component = "."
+		case flags&0x04 != 0:
+			component = ".."
+		case flags&0x08 != 0:
+			component = "/"
+		default:
+			component = string(b[2 : 2+n])
+		}
+		if link != "" && !cont && !strings.HasSuffix(link, "/") {
+			link += "/"
+		}
+		link += component
+		cont = flags&0x01 != 0
+		b = b[2+n:]
+	}
+	return link, cont
+}
+
+// parseISOTimestamps parses TF entry.
+func parseISOTimestamps(rr *isoRockRidge, b []byte) {
+	if len(b) < 1 {
+		return
+	}
+	var (
+		flags = b[0]
+		size  = 7
+		parse = parseISOTime7
+	)
+	if flags&0x80 != 0 {
+		size = 17
+		parse = parseISOTime17
+	}
+	b = b[1:]
+	for i, t := range []*time.Time{
+		&rr.createTime,
+		&rr.modTime,
+		&rr.accessTime,
+		&rr.changeTime,
+	} {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		if len(b) < size {
+			return
+		}
+		*t = parse(b[:size])
+		b = b[size:]
+	}
+}
+
+// parseISOTime7 parses the recording date and time of the directory record.
+func parseISOTime7(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return time.Time{}
+	}
+	loc := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, loc)
+}
+
+// parseISOTime17 parses the date and time of the volume descriptor format, e.g. "2020010203040500" and the offset.
+func parseISOTime17(b []byte) time.Time {
+	digits := func(from, to int) int {
+		x, _ := strconv.Atoi(string(b[from:to]))
+		return x
+	}
+	year := digits(0, 4)
+	if year == 0 {
+		return time.Time{}
+	}
+	loc := time.FixedZone("", int(int8(b[16]))*15*60)
+	return time.Date(year, time.Month(digits(4, 6)), digits(6, 8), digits(8, 10), digits(10, 12), digits(12, 14), digits(14, 16)*int(time.Second/100), loc)
+}
+
+// posixFileMode converts st_mode into fs.FileMode.
+func posixFileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	switch mode & 0o170000 {
+	case 0o040000:
+		m |= fs.ModeDir
+	case 0o120000:
+		m |= fs.ModeSymlink
+	case 0o010000:
+		m |= fs.ModeNamedPipe
+	case 0o140000:
+		m |= fs.ModeSocket
+	case 0o020000:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		m |= fs.ModeDevice
+	}
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// readDir returns the records of the directory except itself and the parent.
+// The records of the multi-extent files are merged.
+func (v *isoVolume) readDir(dir *isoRecord) ([]*isoRecord, error) {
+	if dir.size > isoMaxDirSize {
+		return nil, fmt.Errorf("%w: iso: too large directory: %d", ErrArchive, dir.size)
+	}
+	b := make([]byte, dir.size)
+	if _, err := v.r.ReadAt(b, dir.extents[0].offset); err != nil {
+		return nil, fmt.Errorf("%w: iso: directory: %w", ErrArchive, err)
+	}
+	var (
+		records []*isoRecord
+		multi   *isoRecord
+	)
+	for pos := 0; pos < len(b); {
+		n := int(b[pos])
+		if n == 0 {
+			// the records do not cross the sectors
+			pos = (pos/int(v.blockSize) + 1) * int(v.blockSize)
+			continue
+		}
+		if pos+n > len(b) {
+			return nil, fmt.Errorf("%w: iso: bad directory record", ErrArchive)
+		}
+		r, err := v.parseRecord(b[pos : pos+n])
+		if err != nil {
+			return nil, err
+		}
+		flags := b[pos+25]
+		pos += n
+		if r.name == "." || r.name == ".." {
+			continue
+		}
+		if multi != nil {
+			multi.extents = append(multi.extents, r.extents...)
+			multi.size += r.size
+		} else {
+			records = append(records, r)
+		}
+		if flags&isoFlagMultiExtent != 0 {
+			if multi == nil {
+				multi = r
+			}
+		} else {
+			multi = nil
+		}
+	}
+	return records, nil
+}
+
+// relocatedDir returns the directory relocated by Rock Ridge to the location.
+func (v *isoVolume) relocatedDir(r *isoRecord, location int64) (*isoRecord, error) {
+	b := make([]byte, isoSectorSize)
+	if _, err := v.r.ReadAt(b, location*v.blockSize); err != nil {
+		return nil, fmt.Errorf("%w: iso: relocated directory: %w", ErrArchive, err)
+	}
+	self, err := v.parseRecord(b[:b[0]])
+	if err != nil {
+		return nil, err
+	}
+	self.name = r.name
+	self.rr = r.rr
+	self.dir = true
+	return self, nil
+}
+
+func (w *archiveWalker) walkISO(
+	ctx context.Context,
+	r io.ReaderAt,
+	root, path string,
+	chain []string,
+	send func(Entry, error) bool,
+) error {
+	v, err := newISOVolume(r)
+	if err != nil {
+		return err
+	}
+	visited := map[int64]bool{}
+	return w.walkISODir(ctx, v, v.root, "", visited, root, path, chain, send)
+}
+
+func (w *archiveWalker) walkISODir(
+	ctx context.Context,
+	v *isoVolume,
+	dir *isoRecord,
+	relDir string,
+	visited map[int64]bool,
+	root, path string,
+	chain []string,
+	send func(Entry, error) bool,
+) error {
+	if visited[dir.extents[0].offset] {
+		return fmt.Errorf("%w: iso: directory loop: %s", ErrArchive, relDir)
+	}
+	visited[dir.extents[0].offset] = true
+
+	records, err := v.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, x := range records {
+		if x.rr != nil && x.rr.relocated {
+			// walked by the child link
+			continue
+		}
+		if x.rr != nil && x.rr.childLink >= 0 {
+			if x, err = v.relocatedDir(x, x.rr.childLink); err != nil {
+				return err
+			}
+		}
+		// the name is a component
+		if _, ok := cleanMemberName(x.Name()); !ok || strings.Contains(x.Name(), "/") {
+			slog.Warn("ISOWalker: skip invalid name", slog.String("root", root), slog.String("dir", relDir), slog.String("name", x.Name()))
+			continue
+		}
+		relpath := pathJoinSlash(relDir, x.Name())
+		p := filepath.Join(path, filepath.FromSlash(relpath))
+		slog.Debug("ISOWalker", slog.String("root", root), slog.String("path", p))
+		WalkCallCount.Incr()
+		if syncx.Done(ctx) {
+			return nil
+		}
+		entry := NewEntry(
+			p,
+			x.FileInfo(),
+			EntryAttrs{
+				Chain: chain,
+				ISO:   newISOEntry(root, relpath, v.extension, x),
+			},
+		)
+		if x.dir {
+			if w.isRejected(entry, nil) {
+				// prune
+				continue
+			}
+			WalkDirCount.Incr()
+			if err := w.walkISODir(ctx, v, x, relpath, visited, root, path, chain, send); err != nil {
+				return err
+			}
+			continue
+		}
+		if !w.emit(entry, send) {
+			continue
+		}
+		w.descend(ctx, entry, relpath, func() (io.ReadCloser, error) {
+			return io.NopCloser(x.open(v.r)), nil
+		}, root, chain, send)
+	}
+	return nil
+}
+
+func pathJoinSlash(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
+func newISOEntry(root, relpath string, extension ISOExtension, r *isoRecord) ISOEntry {
+	rr := r.rr
+	if rr == nil {
+		rr = &isoRockRidge{}
+	}
+	return NewISOEntry(
+		root,
+		relpath,
+		string(extension),
+		r.recorded,
+		r.rr != nil && rr.hasMode,
+		rr.uid,
+		rr.gid,
+		rr.nlink,
+		rr.linkname,
+		rr.accessTime,
+		rr.changeTime,
+		rr.createTime,
+	)
+}
@@ -0,0 +1,76 @@
+// Code generated by "dataclass -type ISOEntry -field Root string|RelPath string|Extension string|RecordedTime time.Time|RockRidge bool|Uid int|Gid int|Nlink int|Linkname string|AccessTime time.Time|ChangeTime time.Time|CreationTime time.Time -output isoentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+import "time"
+
+type ISOEntry interface {
+	Root() string
+	RelPath() string
+	Extension() string
+	RecordedTime() time.Time
+	RockRidge() bool
+	Uid() int
+	Gid() int
+	Nlink() int
+	Linkname() string
+	AccessTime() time.Time
+	ChangeTime() time.Time
+	CreationTime() time.Time
+}
+type iSOEntry struct {
+	root         string
+	relPath      string
+	extension    string
+	recordedTime time.Time
+	rockRidge    bool
+	uid          int
+	gid          int
+	nlink        int
+	linkname     string
+	accessTime   time.Time
+	changeTime   time.Time
+	creationTime time.Time
+}
+
+func (s *iSOEntry) Root() string            { return s.root }
+func (s *iSOEntry) RelPath() string         { return s.relPath }
+func (s *iSOEntry) Extension() string       { return s.extension }
+func (s *iSOEntry) RecordedTime() time.Time { return s.recordedTime }
+func (s *iSOEntry) RockRidge() bool         { return s.rockRidge }
+func (s *iSOEntry) Uid() int                { return s.uid }
+func (s *iSOEntry) Gid() int                { return s.gid }
+func (s *iSOEntry) Nlink() int              { return s.nlink }
+func (s *iSOEntry) Linkname() string        { return s.linkname }
+func (s *iSOEntry) AccessTime() time.Time   { return s.accessTime }
+func (s *iSOEntry) ChangeTime() time.Time   { return s.changeTime }
+func (s *iSOEntry) CreationTime() time.Time { return s.creationTime }
+func NewISOEntry(
+	root string,
+	relPath string,
+	extension string,
+	recordedTime time.Time,
+	rockRidge bool,
+	uid int,
+	gid int,
+	nlink int,
+	linkname string,
+	accessTime time.Time,
+	changeTime time.Time,
+	creationTime time.Time,
+) ISOEntry {
+	return &iSOEntry{
+		root:         root,
+		relPath:      relPath,
+		extension:    extension,
+		recordedTime: recordedTime,
+		rockRidge:    rockRidge,
+		uid:          uid,
+		gid:          gid,
+		nlink:        nlink,
+		linkname:     linkname,
+		accessTime:   accessTime,
+		changeTime:   changeTime,
+		creationTime: creationTime,
+	}
+}
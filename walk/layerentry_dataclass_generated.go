@@ -0,0 +1,44 @@
+// Code generated by "dataclass -type LayerEntry -field Image string|Platform string|Digest string|Index int|Shadowed bool|ShadowedBy string -output layerentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type LayerEntry interface {
+	Image() string
+	Platform() string
+	Digest() string
+	Index() int
+	Shadowed() bool
+	ShadowedBy() string
+}
+type layerEntry struct {
+	image      string
+	platform   string
+	digest     string
+	index      int
+	shadowed   bool
+	shadowedBy string
+}
+
+func (s *layerEntry) Image() string      { return s.image }
+func (s *layerEntry) Platform() string   { return s.platform }
+func (s *layerEntry) Digest() string     { return s.digest }
+func (s *layerEntry) Index() int         { return s.index }
+func (s *layerEntry) Shadowed() bool     { return s.shadowed }
+func (s *layerEntry) ShadowedBy() string { return s.shadowedBy }
+func NewLayerEntry(
+	image string,
+	platform string,
+	digest string,
+	index int,
+	shadowed bool,
+	shadowedBy string,
+) LayerEntry {
+	return &layerEntry{
+		image:      image,
+		platform:   platform,
+		digest:     digest,
+		index:      index,
+		shadowed:   shadowed,
+		shadowedBy: shadowedBy,
+	}
+}
@@ -0,0 +1,134 @@
+package walk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/goccy/go-yaml"
+)
+
+// LocalConfigName is the name of the directory-local config file.
+const LocalConfigName = ".mf.yaml"
+
+var (
+	ErrLocalConfig = errors.New("LocalConfig")
+)
+
+// LocalConfig is the config of the subtree read from LocalConfigName in a directory.
+// It applies to the entries under the directory, not to the directory itself.
+//
+// The local configs are layered onto the config of the command, from the outermost directory to the innermost:
+//   - exclude rejects the entries in addition to the exclude of the command and the outer local configs
+//   - the probes run after the probes of the command and the outer local configs, the same names are overwritten
+//   - the fields are computed after all the probes, the same names are overwritten
+type LocalConfig struct {
+	// Path is the path of the file.
+	Path string `yaml:"-"`
+	// Exclude is the expression to reject the entries.
+	Exclude string `yaml:"exclude"`
+	// Probe are the probe scripts. Read script from FILE relative to the directory by '@FILE'.
+	Probe []string `yaml:"probe"`
+	// ProbeName are the names of the probes. The N-th unnamed probe is named lN.
+	ProbeName []string `yaml:"pname"`
+	// Fields are the expressions to compute the metadata by names.
+	Fields map[string]string `yaml:"fields"`
+
+	exclude         expr.Expr
+	excludePathOnly bool
+	excludeRefs     References
+}
+
+// Dir returns the directory of the config.
+func (c *LocalConfig) Dir() string { return filepath.Dir(c.Path) }
+
+// ProbeNameAt returns the name of the i-th probe.
+func (c *LocalConfig) ProbeNameAt(i int) string {
+	if i >= 0 && i < len(c.ProbeName) {
+		return c.ProbeName[i]
+	}
+	return fmt.Sprintf("l%d", i)
+}
+
+type localConfigResult struct {
+	config *LocalConfig
+	err    error
+}
+
+// localConfigCache caches the local configs of a walker, so each file is read only once.
+type localConfigCache struct {
+	m sync.Map // path to localConfigResult
+}
+
+func (c *localConfigCache) load(path string) (*LocalConfig, error) {
+	if x, ok := c.m.Load(path); ok {
+		r := x.(localConfigResult)
+		return r.config, r.err
+	}
+	lc, err := ReadLocalConfig(path)
+	c.m.Store(path, localConfigResult{
+		config: lc,
+		err:    err,
+	})
+	return lc, err
+}
+
+// ReadLocalConfig reads the local config file path.
+// Returns an error wrapping fs.ErrNotExist if path does not exist.
+func ReadLocalConfig(path string) (*LocalConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := LocalConfig{
+		Path: path,
+	}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrLocalConfig, path, err)
+	}
+	if c.Exclude != "" {
+		x, err := expr.NewRaw(c.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: exclude: %w", ErrLocalConfig, path, err)
+		}
+		c.exclude = expr.New(x)
+		c.excludePathOnly = !needsStat(c.exclude)
+		c.excludeRefs = ReferencesOf(c.exclude)
+	}
+	return &c, nil
+}
+
+// enterLocalConfig returns the local configs applied to the entries of dir,
+// that is, parent and the local config of dir if exists.
+func (w *FileWalker) enterLocalConfig(parent []*LocalConfig, dir string, send func(Entry, error) bool) []*LocalConfig {
+	if !w.localConfig {
+		return nil
+	}
+	path := filepath.Join(dir, LocalConfigName)
+	c, err := w.localConfigs.load(path)
+	switch {
+	case err == nil:
+		WalkLocalConfigCount.Incr()
+		return append(slices.Clip(parent), c)
+	case errors.Is(err, os.ErrNotExist):
+		return parent
+	default:
+		w.fail(path, nil, err, send)
+		return parent
+	}
+}
+
+func localConfigPaths(locals []*LocalConfig) []string {
+	if len(locals) == 0 {
+		return nil
+	}
+	xs := make([]string, len(locals))
+	for i, x := range locals {
+		xs[i] = x.Path
+	}
+	return xs
+}
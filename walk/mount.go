@@ -0,0 +1,203 @@
+package walk
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/berquerant/metafind/meta"
+)
+
+// mount is an entry of the mount table.
+type mount struct {
+	point  string
+	fsType string
+	source string
+}
+
+// mountTable is the mounts by the mount points.
+// Later mounts take precedence over earlier ones on the same mount point.
+type mountTable map[string]mount
+
+func newMountTable(mounts []mount) mountTable {
+	t := make(mountTable, len(mounts))
+	for _, m := range mounts {
+		t[m.point] = m
+	}
+	return t
+}
+
+// find returns the mount containing path, that has the longest mount point.
+// path should be absolute and have no symlinks.
+func (t mountTable) find(path string) (mount, bool) {
+	for {
+		if m, ok := t[path]; ok {
+			return m, true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return mount{}, false
+		}
+		path = parent
+	}
+}
+
+// parseMountInfo parses the lines of mountinfo like:
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// See proc_pid_mountinfo(5).
+func parseMountInfo(r io.Reader) ([]mount, error) {
+	var (
+		mounts  []mount
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, x := range fields {
+			if x == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || len(fields) < sep+3 {
+			continue
+		}
+		mounts = append(mounts, mount{
+			point:  unescapeMountInfo(fields[4]),
+			fsType: fields[sep+1],
+			source: unescapeMountInfo(fields[sep+2]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountInfo decodes the octal escapes of mountinfo, e.g. \040 is space.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if x, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(x))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// dirMount is the mount of a directory shared by its entries.
+// It is resolved on the first use, so the directories are not resolved unless the mount is referred.
+type dirMount struct {
+	once sync.Once
+	// path is the directory to resolve
+	path string
+	// dir is the absolute path of the directory without symlinks, empty if failed to resolve
+	dir   string
+	mount mount
+	ok    bool
+}
+
+// newDirMount returns the mount of dir, resolving the symlinks on the first use.
+func newDirMount(dir string) *dirMount {
+	return &dirMount{
+		path: dir,
+	}
+}
+
+// newResolvedDirMount returns the mount of the resolved directory dir.
+func newResolvedDirMount(dir string, m mount, ok bool) *dirMount {
+	d := &dirMount{
+		path:  dir,
+		dir:   dir,
+		mount: m,
+		ok:    ok,
+	}
+	d.once.Do(func() {})
+	return d
+}
+
+func (d *dirMount) resolve() {
+	d.once.Do(func() {
+		table := loadMounts()
+		if len(table) == 0 {
+			return
+		}
+		p, err := filepath.Abs(d.path)
+		if err != nil {
+			return
+		}
+		if x, err := filepath.EvalSymlinks(p); err == nil {
+			p = x
+		}
+		d.dir = p
+		d.mount, d.ok = table.find(p)
+	})
+}
+
+// enter returns the mount of the subdirectory name at path.
+// The symlinks are resolved again only if the subdirectory is a symlink.
+func (d *dirMount) enter(path, name string, symlink bool) *dirMount {
+	if d == nil {
+		return nil
+	}
+	if symlink {
+		return newDirMount(path)
+	}
+	d.resolve()
+	if d.dir == "" {
+		return newDirMount(path)
+	}
+	dir := filepath.Join(d.dir, name)
+	if m, ok := loadMounts()[dir]; ok {
+		return newResolvedDirMount(dir, m, true)
+	}
+	return newResolvedDirMount(dir, d.mount, d.ok)
+}
+
+// find returns the mount containing the entry name of the directory.
+func (d *dirMount) find(name string) (mount, bool) {
+	if d == nil {
+		return mount{}, false
+	}
+	d.resolve()
+	if d.dir == "" {
+		return mount{}, false
+	}
+	if m, ok := loadMounts()[filepath.Join(d.dir, name)]; ok {
+		// the entry is a mount point
+		return m, true
+	}
+	return d.mount, d.ok
+}
+
+// newMountMetadata returns the mount containing the entry on the file system.
+func newMountMetadata(entry Entry) *meta.Data {
+	if len(entry.Chain()) > 0 {
+		// in archive
+		return nil
+	}
+	d := entry.Attrs().mount
+	if d == nil {
+		// the root, or not from the directory walk
+		d = newDirMount(filepath.Dir(entry.Path()))
+	}
+	m, ok := d.find(filepath.Base(entry.Path()))
+	if !ok {
+		return nil
+	}
+	return meta.NewData(map[string]any{
+		"mount_point":  m.point,
+		"fs_type":      m.fsType,
+		"mount_source": m.source,
+	})
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package walk
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/berquerant/metafind/logx"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// loadMounts reads the mount table once.
+var loadMounts = sync.OnceValue(func() mountTable {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		slog.Warn("mountinfo", logx.Err(err))
+		return nil
+	}
+	defer f.Close()
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		slog.Warn("mountinfo", logx.Err(err))
+	}
+	return newMountTable(mounts)
+})
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package walk
+
+// loadMounts is not available on this platform.
+func loadMounts() mountTable { return nil }
@@ -0,0 +1,186 @@
+package walk
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/syncx"
+)
+
+// walkParallel walks the tree under root like filepath.Walk, but reads directories by w.parallel goroutines,
+// follows the symlinks if followSymlinks is enabled, reads the local configs if localConfig is enabled,
+// sends the directories after their subtrees if dirs is enabled, and adds the parent metadata if parent is enabled.
+func (w *FileWalker) walkParallel(ctx context.Context, root *walkRoot, send func(Entry, error) bool) {
+	WalkCallCount.Incr()
+	info, err := os.Lstat(root.path)
+	if err != nil {
+		w.fail(root.path, nil, err, send)
+		return
+	}
+	result, entry := w.visit(ctx, root, root.path, 0, info, nil, nil, send)
+	if result != visitDescend {
+		return
+	}
+	var stat *dirStat
+	if w.dirs {
+		stat = newDirStat(entry, nil, w.minDepth == 0)
+	}
+	var ignores *ignoreList
+	if w.gitignore != GitignoreNone {
+		ignores = newIgnoreList(root.path)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, w.parallel-1)
+	)
+	var walkDir func(path string, depth int, info fs.FileInfo, ancestors []string, ignores *ignoreList, locals []*LocalConfig, stat *dirStat, mount *dirMount)
+	walkDir = func(path string, depth int, info fs.FileInfo, ancestors []string, ignores *ignoreList, locals []*LocalConfig, stat *dirStat, mount *dirMount) {
+		defer stat.done(send)
+		if w.followSymlinks {
+			// detect the loop by the ancestor directories
+			if id, ok := dirID(path); ok {
+				if slices.Contains(ancestors, id) {
+					stat.discard()
+					w.fail(path, info, ErrSymlinkLoop, send)
+					return
+				}
+				ancestors = append(slices.Clip(ancestors), id)
+			}
+		}
+		entries, err := os.ReadDir(path)
+		slog.Debug("FileWalker: parallel", slog.String("path", path), logx.Err(err))
+		if err != nil {
+			// continue walking past the unreadable path
+			stat.discard()
+			w.fail(path, info, err, send)
+			return
+		}
+		locals = w.enterLocalConfig(locals, path, send)
+		dir := &dirContext{
+			locals: locals,
+			stat:   stat,
+			parent: w.newParentEntry(path, entries),
+			mount:  mount,
+		}
+		for _, x := range entries {
+			WalkCallCount.Incr()
+			if syncx.Done(ctx) {
+				return
+			}
+			var (
+				p    = filepath.Join(path, x.Name())
+				info = newDirEntryInfo(x)
+			)
+			if ignores.skip(x.Name()) {
+				continue
+			}
+			ignore := ignores.match(x.Name(), x.IsDir())
+			if w.gitignore == GitignorePrune && ignore.Ignored() {
+				WalkIgnoreCount.Incr()
+				continue
+			}
+			result, entry := w.visit(ctx, root, p, depth+1, info, ignore, dir, send)
+			if result != visitDescend {
+				continue
+			}
+			ignores := ignores.enter(p, x.Name(), ignore)
+			mount := mount.enter(p, x.Name(), isSymlink(info))
+			var child *dirStat
+			if stat != nil {
+				stat.enter()
+				child = newDirStat(entry, stat, depth+1 >= w.minDepth)
+			}
+			select {
+			case sem <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer func() {
+						<-sem
+						wg.Done()
+					}()
+					walkDir(p, depth+1, info, ancestors, ignores, locals, child, mount)
+				}()
+			default:
+				walkDir(p, depth+1, info, ancestors, ignores, locals, child, mount)
+			}
+		}
+	}
+	walkDir(root.path, 0, info, nil, ignores, nil, stat, newDirMount(root.path))
+	wg.Wait()
+}
+
+// dirID returns the device and the inode of the directory path, following the symlinks.
+func dirID(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	return fileID(info)
+}
+
+var _ fs.FileInfo = &dirEntryInfo{}
+
+// dirEntryInfo is fs.FileInfo from fs.DirEntry.
+// It calls lstat only when the fields other than the name and the type are required.
+type dirEntryInfo struct {
+	entry fs.DirEntry
+	once  sync.Once
+	info  fs.FileInfo
+}
+
+func newDirEntryInfo(entry fs.DirEntry) *dirEntryInfo {
+	return &dirEntryInfo{
+		entry: entry,
+	}
+}
+
+func (i *dirEntryInfo) stat() fs.FileInfo {
+	i.once.Do(func() {
+		info, err := i.entry.Info()
+		if err != nil {
+			slog.Debug("FileWalker: lstat", slog.String("name", i.entry.Name()), logx.Err(err))
+			return
+		}
+		i.info = info
+	})
+	return i.info
+}
+
+func (i *dirEntryInfo) Name() string { return i.entry.Name() }
+func (i *dirEntryInfo) IsDir() bool  { return i.entry.IsDir() }
+
+func (i *dirEntryInfo) Mode() fs.FileMode {
+	if x := i.stat(); x != nil {
+		return x.Mode()
+	}
+	return i.entry.Type()
+}
+
+func (i *dirEntryInfo) Size() int64 {
+	if x := i.stat(); x != nil {
+		return x.Size()
+	}
+	return 0
+}
+
+func (i *dirEntryInfo) ModTime() time.Time {
+	if x := i.stat(); x != nil {
+		return x.ModTime()
+	}
+	return time.Time{}
+}
+
+func (i *dirEntryInfo) Sys() any {
+	if x := i.stat(); x != nil {
+		return x.Sys()
+	}
+	return nil
+}
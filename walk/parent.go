@@ -0,0 +1,82 @@
+package walk
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// dirContext is the state of a directory shared by its entries.
+type dirContext struct {
+	// locals are the local configs applied to the entries
+	locals []*LocalConfig
+	// stat is nil if dirs is disabled
+	stat *dirStat
+	// parent is nil if parent is disabled
+	parent ParentEntry
+	// mount is nil if the mount table is not available
+	mount *dirMount
+}
+
+func (d *dirContext) localConfigs() []*LocalConfig {
+	if d == nil {
+		return nil
+	}
+	return d.locals
+}
+
+func (d *dirContext) dirStat() *dirStat {
+	if d == nil {
+		return nil
+	}
+	return d.stat
+}
+
+func (d *dirContext) dirMount() *dirMount {
+	if d == nil {
+		return nil
+	}
+	return d.mount
+}
+
+func (d *dirContext) parentEntry() ParentEntry {
+	if d == nil {
+		return nil
+	}
+	return d.parent
+}
+
+// newParentEntry returns the metadata of the directory dir shared by its entries.
+// Returns nil if parent is disabled.
+func (w *FileWalker) newParentEntry(dir string, entries []fs.DirEntry) ParentEntry {
+	if !w.parent {
+		return nil
+	}
+	var (
+		names       = make([]string, len(entries))
+		markers     = make(map[string]bool, len(w.parentMarkers))
+		subdirCount int
+	)
+	for i, x := range entries {
+		names[i] = x.Name()
+		if x.IsDir() {
+			subdirCount++
+		}
+	}
+	for _, pattern := range w.parentMarkers {
+		markers[pattern] = false
+		for _, name := range names {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				markers[pattern] = true
+				break
+			}
+		}
+	}
+	return NewParentEntry(
+		dir,
+		len(entries),
+		len(entries)-subdirCount,
+		subdirCount,
+		names,
+		markers,
+	)
+}
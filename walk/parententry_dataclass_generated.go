@@ -0,0 +1,44 @@
+// Code generated by "dataclass -type ParentEntry -field Path string|EntryCount int|FileCount int|SubdirCount int|Names []string|Markers map[string]bool -output parententry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type ParentEntry interface {
+	Path() string
+	EntryCount() int
+	FileCount() int
+	SubdirCount() int
+	Names() []string
+	Markers() map[string]bool
+}
+type parentEntry struct {
+	path        string
+	entryCount  int
+	fileCount   int
+	subdirCount int
+	names       []string
+	markers     map[string]bool
+}
+
+func (s *parentEntry) Path() string             { return s.path }
+func (s *parentEntry) EntryCount() int          { return s.entryCount }
+func (s *parentEntry) FileCount() int           { return s.fileCount }
+func (s *parentEntry) SubdirCount() int         { return s.subdirCount }
+func (s *parentEntry) Names() []string          { return s.names }
+func (s *parentEntry) Markers() map[string]bool { return s.markers }
+func NewParentEntry(
+	path string,
+	entryCount int,
+	fileCount int,
+	subdirCount int,
+	names []string,
+	markers map[string]bool,
+) ParentEntry {
+	return &parentEntry{
+		path:        path,
+		entryCount:  entryCount,
+		fileCount:   fileCount,
+		subdirCount: subdirCount,
+		names:       names,
+		markers:     markers,
+	}
+}
@@ -0,0 +1,96 @@
+package walk
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// ExcludePresets are the named sets of the name patterns of the junk files and directories.
+// The patterns are matched against the names of the entries by filepath.Match.
+var ExcludePresets = map[string][]string{
+	"vcs": {
+		".git",
+		".svn",
+		".hg",
+		".bzr",
+		"_darcs",
+		"CVS",
+		".fslckout",
+	},
+	"deps": {
+		"node_modules",
+		"bower_components",
+		"jspm_packages",
+		".venv",
+		"venv",
+		"__pypackages__",
+		".bundle",
+	},
+	"caches": {
+		".cache",
+		"__pycache__",
+		".pytest_cache",
+		".mypy_cache",
+		".ruff_cache",
+		".tox",
+		".nox",
+		".gradle",
+		".parcel-cache",
+		".sass-cache",
+		".next",
+		".terraform",
+	},
+	"os-junk": {
+		".DS_Store",
+		"._*",
+		".AppleDouble",
+		".Spotlight-V100",
+		".Trashes",
+		".fseventsd",
+		"Thumbs.db",
+		"ehthumbs.db",
+		"desktop.ini",
+		"$RECYCLE.BIN",
+	},
+}
+
+var (
+	ErrUnknownPreset = errors.New("UnknownPreset")
+	ErrBadPattern    = errors.New("BadPattern")
+)
+
+// ResolvePresets returns the patterns of the presets.
+// extra adds the presets or overrides ExcludePresets.
+func ResolvePresets(names []string, extra map[string][]string) ([]string, error) {
+	var patterns []string
+	for _, name := range names {
+		xs, ok := extra[name]
+		if !ok {
+			xs, ok = ExcludePresets[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPreset, name)
+		}
+		for _, x := range xs {
+			if _, err := filepath.Match(x, ""); err != nil {
+				return nil, fmt.Errorf("%w: %s in preset %s", ErrBadPattern, x, name)
+			}
+			if !slices.Contains(patterns, x) {
+				patterns = append(patterns, x)
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// isPruned returns true if name matches the patterns of the presets.
+func (w *FileWalker) isPruned(name string) bool {
+	for _, x := range w.prunePatterns {
+		if ok, _ := filepath.Match(x, name); ok {
+			return true
+		}
+	}
+	return false
+}
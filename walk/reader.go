@@ -3,87 +3,204 @@ package walk
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"iter"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/meta"
 	"github.com/berquerant/metafind/syncx"
 )
 
 var _ Walker = &ReaderWalker{}
 
+type ReaderOption func(*ReaderWalker)
+
+// WithNull makes ReaderWalker read the paths separated by NUL instead of newline, like find -print0.
+func WithNull(enabled bool) ReaderOption {
+	return func(w *ReaderWalker) {
+		w.null = enabled
+	}
+}
+
+// WithJSON makes ReaderWalker read JSON objects instead of paths.
+// The path field is the path, and the other fields are added to the metadata of the entries under the path.
+// The fields do not overwrite the metadata of the entries, e.g. size,
+// and the objects having the fields of reservedExtraKeys are rejected.
+func WithJSON(enabled bool) ReaderOption {
+	return func(w *ReaderWalker) {
+		w.json = enabled
+	}
+}
+
+var (
+	ErrReaderJSON = errors.New("ReaderJSON")
+)
+
+// reservedExtraKeys are the keys of the metadata telling what and where the file is,
+// that the fields of the json objects cannot use.
+var reservedExtraKeys = slices.Concat(pathMetadataKeys, []string{
+	"compression",
+	"compressed_path",
+	"archive_chain",
+	"archive_parent",
+	"archive_depth",
+	"git_repo",
+	"git_revision",
+	"git_commit",
+	"git_mode",
+	"git_type",
+	"git_object",
+})
+
+// FileEntryWalker is a Walker that also makes the entries of the files given as the paths.
+type FileEntryWalker interface {
+	Walker
+	// FileEntry returns the entry of the file path.
+	FileEntry(path string, info fs.FileInfo) Entry
+}
+
 // ReaderWalker receives paths from io.Reader and walks under them.
+// By default, the paths are separated by newline, and the environment variables in them are expanded.
+// The length of the lines is not limited.
 type ReaderWalker struct {
 	r          io.Reader
-	fileWalker Walker
-	err        error
+	fileWalker FileEntryWalker
+	null       bool
+	json       bool
 }
 
-func NewReader(r io.Reader, fileWalker Walker) *ReaderWalker {
-	return &ReaderWalker{
+func NewReader(r io.Reader, fileWalker FileEntryWalker, opt ...ReaderOption) *ReaderWalker {
+	w := &ReaderWalker{
 		r:          r,
 		fileWalker: fileWalker,
 	}
+	for _, f := range opt {
+		f(w)
+	}
+	return w
 }
 
-func (w ReaderWalker) Err() error { return w.err }
+// readerInput is a path read from io.Reader.
+type readerInput struct {
+	path  string
+	extra *meta.Data
+}
 
-func (w *ReaderWalker) Walk(_ string) iter.Seq[Entry] {
-	w.err = nil
+// parse returns the input of the token separated by the delimiter.
+func (w *ReaderWalker) parse(token string) (*readerInput, error) {
+	if !w.null {
+		token = strings.TrimSuffix(token, "\r")
+	}
+	if !w.json {
+		if !w.null {
+			token = os.ExpandEnv(token)
+		}
+		return &readerInput{
+			path: token,
+		}, nil
+	}
 
-	return func(yield func(Entry) bool) {
-		resultC := make(chan Entry, walkerBufferSize)
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	if strings.TrimSpace(token) == "" {
+		return &readerInput{}, nil
+	}
+	var d map[string]any
+	if err := json.Unmarshal([]byte(token), &d); err != nil {
+		return nil, fmt.Errorf("%w: %w: %s", ErrReaderJSON, err, token)
+	}
+	path, ok := d["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no path: %s", ErrReaderJSON, token)
+	}
+	delete(d, "path")
+	for k := range d {
+		if slices.Contains(reservedExtraKeys, k) {
+			return nil, fmt.Errorf("%w: reserved key %s: %s", ErrReaderJSON, k, token)
+		}
+	}
+	x := &readerInput{
+		path: path,
+	}
+	if len(d) > 0 {
+		x.extra = meta.NewData(d)
+	}
+	return x, nil
+}
 
-		go func() {
-			defer close(resultC)
+func (w *ReaderWalker) Walk(ctx context.Context, _ string) iter.Seq2[Entry, error] {
+	delim := byte('\n')
+	if w.null {
+		delim = 0
+	}
 
-			if syncx.Done(ctx) {
-				return
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		r := bufio.NewReader(w.r)
+		for !syncx.Done(ctx) {
+			token, readErr := r.ReadString(delim)
+			if readErr != nil && !errors.Is(readErr, io.EOF) {
+				return readErr
 			}
-
-			scanner := bufio.NewScanner(w.r)
-			for scanner.Scan() {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					path := os.ExpandEnv(scanner.Text())
-					info, err := os.Stat(path)
-					slog.Debug("ReaderWalker", slog.String("path", path), logx.Err(err))
-					if os.IsNotExist(err) {
-						continue
-					}
-
-					if err != nil {
-						w.err = err
-						return
-					}
-					if info.IsDir() {
-						for x := range w.fileWalker.Walk(path) {
-							resultC <- x
-						}
-						if err := w.fileWalker.Err(); err != nil {
-							slog.Warn("ReaderWalker", slog.String("path", path), logx.Err(err))
-						}
-						continue
-					}
-					resultC <- NewEntry(path, info, nil)
-				}
+			if token == "" && readErr != nil {
+				return nil
 			}
-
-			if err := scanner.Err(); err != nil {
-				w.err = err
+			if !w.walkToken(ctx, strings.TrimSuffix(token, string(delim)), send) {
+				return nil
 			}
-		}()
+			if readErr != nil {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// walkToken sends the entries of the path of token.
+// Returns false if send returns false.
+func (w *ReaderWalker) walkToken(ctx context.Context, token string, send func(Entry, error) bool) bool {
+	input, err := w.parse(token)
+	if err != nil {
+		WalkErrCount.Incr()
+		return send(nil, err)
+	}
+
+	path := input.path
+	info, err := os.Stat(path)
+	slog.Debug("ReaderWalker", slog.String("path", path), logx.Err(err))
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		WalkErrCount.Incr()
+		return send(nil, err)
+	}
 
-		for x := range resultC {
-			if !yield(x) {
-				return
+	if info.IsDir() {
+		for x, err := range w.fileWalker.Walk(ctx, path) {
+			if x != nil && input.extra != nil {
+				x = withExtra(x, input.extra)
+			}
+			if !send(x, err) {
+				return false
 			}
 		}
+		return true
+	}
+	entry := w.fileWalker.FileEntry(path, info)
+	if input.extra != nil {
+		entry = withExtra(entry, input.extra)
 	}
+	return send(entry, nil)
+}
+
+func withExtra(entry Entry, extra *meta.Data) Entry {
+	attrs := entry.Attrs()
+	attrs.Extra = extra
+	return NewEntry(entry.Path(), entry.Info(), attrs)
 }
@@ -0,0 +1,107 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+)
+
+const (
+	SchemeFile  = "file"
+	SchemeZip   = "zip"
+	SchemeTar   = "tar"
+	SchemeAr    = "ar"
+	SchemeImage = "image"
+	SchemeISO   = "iso"
+	SchemeGit   = "git"
+	SchemeIndex = "index"
+	SchemeStdin = "stdin"
+
+	schemeSep = "://"
+	stdinMark = "-"
+)
+
+var (
+	ErrUnknownScheme = errors.New("UnknownScheme")
+)
+
+// ParseRoot splits root into the scheme and the path.
+//
+// "zip:///a.zip" is ("zip", "/a.zip"), "-" is ("stdin", "-"),
+// and the root without scheme is ("file", root).
+func ParseRoot(root string) (scheme, path string) {
+	if root == stdinMark {
+		return SchemeStdin, root
+	}
+	scheme, path, ok := strings.Cut(root, schemeSep)
+	if !ok {
+		return SchemeFile, root
+	}
+	return scheme, path
+}
+
+// NewRoot joins scheme and path into the root.
+func NewRoot(scheme, path string) string {
+	return scheme + schemeSep + path
+}
+
+// Registry maps the schemes of the roots to the walkers.
+type Registry struct {
+	walkers map[string]Walker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		walkers: map[string]Walker{},
+	}
+}
+
+func (r *Registry) Register(scheme string, w Walker) { r.walkers[scheme] = w }
+
+func (r *Registry) Get(scheme string) (Walker, bool) {
+	w, ok := r.walkers[scheme]
+	return w, ok
+}
+
+var _ Walker = &RegistryWalker{}
+
+// RegistryWalker walks the root by the walker registered for the scheme of the root.
+type RegistryWalker struct {
+	registry *Registry
+}
+
+func NewRegistryWalker(registry *Registry) *RegistryWalker {
+	return &RegistryWalker{
+		registry: registry,
+	}
+}
+
+func (w *RegistryWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		scheme, path := ParseRoot(root)
+		walker, ok := w.registry.Get(scheme)
+		if !ok {
+			yield(nil, fmt.Errorf("%w: %s", ErrUnknownScheme, root))
+			return
+		}
+		for x, err := range walker.Walk(ctx, path) {
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+			if !yield(withSource(x, root), nil) {
+				return
+			}
+		}
+	}
+}
+
+func withSource(entry Entry, source string) Entry {
+	attrs := entry.Attrs()
+	attrs.Source = source
+	return NewEntry(entry.Path(), entry.Info(), attrs)
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package walk
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+
+	"github.com/berquerant/metafind/meta"
+	"golang.org/x/sys/unix"
+)
+
+// newStatMetadata returns the metadata from syscall.Stat_t of the entry on the file system.
+// The creation time is read by statx(2) only if birthTime is true.
+func newStatMetadata(entry Entry, birthTime bool) *meta.Data {
+	info := entry.Info()
+	if info == nil || len(entry.Chain()) > 0 {
+		return nil
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	var (
+		atime = time.Unix(st.Atim.Unix())
+		ctime = time.Unix(st.Ctim.Unix())
+	)
+	data := meta.NewData(map[string]any{
+		"uid":            int(st.Uid),
+		"gid":            int(st.Gid),
+		"user":           lookupUser(st.Uid),
+		"group":          lookupGroup(st.Gid),
+		"inode":          st.Ino,
+		"dev":            st.Dev,
+		"nlink":          st.Nlink,
+		"blocks":         st.Blocks,
+		"allocated_size": st.Blocks * 512,
+		"atime":          atime.Format(time.DateTime),
+		"atime_ts":       atime.Unix(),
+		"ctime":          ctime.Format(time.DateTime),
+		"ctime_ts":       ctime.Unix(),
+	})
+	if !birthTime {
+		return data
+	}
+	if btime, ok := readBirthTime(entry.Path(), entry.Link() != "" && info.Mode()&fs.ModeSymlink == 0); ok {
+		data.Set("btime", btime.Format(time.DateTime))
+		data.Set("btime_ts", btime.Unix())
+	}
+	return data
+}
+
+// readBirthTime returns the creation time of path by statx(2) if the file system provides it.
+func readBirthTime(path string, follow bool) (time.Time, bool) {
+	flags := unix.AT_STATX_SYNC_AS_STAT
+	if !follow {
+		flags |= unix.AT_SYMLINK_NOFOLLOW
+	}
+	var x unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, flags, unix.STATX_BTIME, &x); err != nil {
+		return time.Time{}, false
+	}
+	if x.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(x.Btime.Sec, int64(x.Btime.Nsec)), true
+}
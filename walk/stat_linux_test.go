@@ -0,0 +1,94 @@
+//go:build linux
+
+package walk_test
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/berquerant/metafind/walk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatMetadata(t *testing.T) {
+	d := t.TempDir()
+	touch := func(t *testing.T, p string) {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		sroot = filepath.Join(d, "sroot")
+		s1    = filepath.Join(d, "sroot", "s1")
+		s2    = filepath.Join(d, "sroot", "s2")
+		s3    = filepath.Join(d, "sroot", "s3")
+	)
+	if err := os.MkdirAll(sroot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, s1)
+	touch(t, s3)
+	if err := os.Link(s1, s2); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), s1))
+		assert.Nil(t, err)
+		if !assert.Len(t, r, 1) {
+			return
+		}
+		data := walk.NewMetaData(r[0])
+		get := func(k string) any {
+			x, _ := data.Get(k)
+			return x
+		}
+		var st syscall.Stat_t
+		if err := syscall.Stat(s1, &st); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, os.Getuid(), get("uid"))
+		assert.Equal(t, os.Getgid(), get("gid"))
+		assert.Equal(t, st.Ino, get("inode"))
+		assert.Equal(t, st.Dev, get("dev"))
+		assert.Equal(t, st.Nlink, get("nlink"))
+		assert.Equal(t, st.Blocks*512, get("allocated_size"))
+		assert.Equal(t, st.Ctim.Sec, get("ctime_ts"))
+		if u, err := user.Current(); err == nil {
+			assert.Equal(t, u.Username, get("user"))
+		}
+	})
+
+	t.Run("btime only if referred", func(t *testing.T) {
+		r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), s1))
+		assert.Nil(t, err)
+		if !assert.Len(t, r, 1) {
+			return
+		}
+		data := walk.NewMetaDataOf(r[0], walk.ReferencesOf(expr.MustNewRaw(`size > 0`)))
+		assert.NotContains(t, data.Unwrap(), "btime")
+		assert.NotContains(t, data.Unwrap(), "btime_ts")
+		assert.Contains(t, data.Unwrap(), "ctime_ts")
+
+		data = walk.NewMetaDataOf(r[0], walk.ReferencesOf(expr.MustNewRaw(`btime_ts > 0`)))
+		if _, ok := data.Get("btime_ts"); !ok {
+			t.Skip("btime is not supported")
+		}
+		assert.Contains(t, data.Unwrap(), "btime")
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		exclude := expr.New(expr.MustNewRaw(`!is_dir && nlink > 1`))
+		r, err := collectEntries(walk.NewFile(exclude).Walk(context.TODO(), sroot))
+		assert.Nil(t, err)
+		if assert.Len(t, r, 1) {
+			assert.Equal(t, s3, r[0].Path())
+		}
+	})
+}
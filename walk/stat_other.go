@@ -0,0 +1,8 @@
+//go:build !linux
+
+package walk
+
+import "github.com/berquerant/metafind/meta"
+
+// newStatMetadata is not available on this platform.
+func newStatMetadata(_ Entry, _ bool) *meta.Data { return nil }
@@ -0,0 +1,91 @@
+package walk
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"os"
+
+	"github.com/berquerant/metafind/expr"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var _ Walker = &TarWalker{}
+
+func NewTar(exclude expr.Expr, opt ...ArchiveOption) *TarWalker {
+	return &TarWalker{
+		archiveWalker: newArchiveWalker(exclude, opt...),
+	}
+}
+
+// TarWalker walks files in tar, tar.gz, tar.bz2, tar.xz or tar.zst.
+type TarWalker struct {
+	archiveWalker
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// newTarReader returns a tar reader, decompressing r if needed.
+// closer releases the decompressor.
+func newTarReader(r io.Reader) (*tar.Reader, func(), error) {
+	dr, closer, err := newDecompressReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(dr), closer, nil
+}
+
+// newDecompressReader returns the reader decompressing r by gzip, bzip2, xz or zstd detected by the magic number,
+// or r as is if it is not compressed.
+func newDecompressReader(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(xzMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	nop := func() {}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gr, nop, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(br), nop, nil
+	case bytes.HasPrefix(magic, xzMagic):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, nop, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	default:
+		return br, nop, nil
+	}
+}
+
+func (w *TarWalker) Walk(ctx context.Context, root string) iter.Seq2[Entry, error] {
+	WalkCount.Incr()
+	root = os.ExpandEnv(root)
+	return walkAsync(ctx, func(ctx context.Context, send func(Entry, error) bool) error {
+		return w.walkArchive(ctx, archiveTar, root, send)
+	})
+}
@@ -0,0 +1,59 @@
+// Code generated by "dataclass -type TarEntry -field Root string|RelPath string|Typeflag string|Uid int|Gid int|Uname string|Gname string|Linkname string|PAXRecords map[string]string -output tarentry_dataclass_generated.go"; DO NOT EDIT.
+
+package walk
+
+type TarEntry interface {
+	Root() string
+	RelPath() string
+	Typeflag() string
+	Uid() int
+	Gid() int
+	Uname() string
+	Gname() string
+	Linkname() string
+	PAXRecords() map[string]string
+}
+type tarEntry struct {
+	root       string
+	relPath    string
+	typeflag   string
+	uid        int
+	gid        int
+	uname      string
+	gname      string
+	linkname   string
+	pAXRecords map[string]string
+}
+
+func (s *tarEntry) Root() string                  { return s.root }
+func (s *tarEntry) RelPath() string               { return s.relPath }
+func (s *tarEntry) Typeflag() string              { return s.typeflag }
+func (s *tarEntry) Uid() int                      { return s.uid }
+func (s *tarEntry) Gid() int                      { return s.gid }
+func (s *tarEntry) Uname() string                 { return s.uname }
+func (s *tarEntry) Gname() string                 { return s.gname }
+func (s *tarEntry) Linkname() string              { return s.linkname }
+func (s *tarEntry) PAXRecords() map[string]string { return s.pAXRecords }
+func NewTarEntry(
+	root string,
+	relPath string,
+	typeflag string,
+	uid int,
+	gid int,
+	uname string,
+	gname string,
+	linkname string,
+	pAXRecords map[string]string,
+) TarEntry {
+	return &tarEntry{
+		root:       root,
+		relPath:    relPath,
+		typeflag:   typeflag,
+		uid:        uid,
+		gid:        gid,
+		uname:      uname,
+		gname:      gname,
+		linkname:   linkname,
+		pAXRecords: pAXRecords,
+	}
+}
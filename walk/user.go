@@ -0,0 +1,38 @@
+package walk
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+var (
+	userCache  sync.Map // uid to user name
+	groupCache sync.Map // gid to group name
+)
+
+// lookupUser returns the name of the user uid, or empty string if not found.
+func lookupUser(uid uint32) string {
+	if x, ok := userCache.Load(uid); ok {
+		return x.(string)
+	}
+	var name string
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		name = u.Username
+	}
+	userCache.Store(uid, name)
+	return name
+}
+
+// lookupGroup returns the name of the group gid, or empty string if not found.
+func lookupGroup(gid uint32) string {
+	if x, ok := groupCache.Load(gid); ok {
+		return x.(string)
+	}
+	var name string
+	if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+		name = g.Name
+	}
+	groupCache.Store(gid, name)
+	return name
+}
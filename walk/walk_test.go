@@ -1,20 +1,36 @@
 package walk_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"iter"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/berquerant/metafind/expr"
 	"github.com/berquerant/metafind/logx"
+	"github.com/berquerant/metafind/meta"
 	"github.com/berquerant/metafind/walk"
 	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
 )
 
 func TestWalker(t *testing.T) {
@@ -109,9 +125,9 @@ func TestWalker(t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
 				r := bytes.NewBufferString(strings.Join(tc.input, "\n"))
 				w := walk.NewReader(r, walk.NewFile(nil))
-				result := slices.Collect(w.Walk(""))
-				if !assert.Nil(t, w.Err()) {
-					t.Errorf("%#v", w.Err())
+				result, err := collectEntries(w.Walk(context.TODO(), ""))
+				if !assert.Nil(t, err) {
+					t.Errorf("%#v", err)
 				}
 
 				got := make([]string, len(result))
@@ -124,6 +140,79 @@ func TestWalker(t *testing.T) {
 				assert.Equal(t, tc.want, got)
 			})
 		}
+
+		t.Run("null", func(t *testing.T) {
+			r := bytes.NewBufferString(strings.Join([]string{f1, f2 + "\nnotexist", d31}, "\x00") + "\x00")
+			w := walk.NewReader(r, walk.NewFile(nil), walk.WithNull(true))
+			result, err := collectEntries(w.Walk(context.TODO(), ""))
+			assert.Nil(t, err)
+			got := make([]string, len(result))
+			for i, x := range result {
+				got[i] = x.Path()
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{f1, f3}, got)
+		})
+
+		t.Run("json", func(t *testing.T) {
+			long := strings.Repeat("x", 100*1024)
+			r := bytes.NewBufferString(strings.Join([]string{
+				fmt.Sprintf(`{"path":%q,"tag":"file","long":%q}`, f1, long),
+				fmt.Sprintf(`{"path":%q,"tag":"dir"}`, d3),
+				"",
+			}, "\n"))
+			w := walk.NewReader(r, walk.NewFile(nil), walk.WithJSON(true))
+			result, err := collectEntries(w.Walk(context.TODO(), ""))
+			assert.Nil(t, err)
+			got := map[string]any{}
+			for _, x := range result {
+				data := walk.NewMetaData(x)
+				got[x.Path()], _ = data.Get("tag")
+				if x.Path() == f1 {
+					v, _ := data.Get("long")
+					assert.Equal(t, long, v)
+				}
+			}
+			assert.Equal(t, map[string]any{
+				f1: "file",
+				f2: "dir",
+				f3: "dir",
+			}, got)
+		})
+
+		t.Run("json invalid", func(t *testing.T) {
+			r := bytes.NewBufferString(strings.Join([]string{`{"tag":"x"}`, `{`, f1}, "\n"))
+			w := walk.NewReader(r, walk.NewFile(nil), walk.WithJSON(true))
+			_, err := collectEntries(w.Walk(context.TODO(), ""))
+			assert.ErrorIs(t, err, walk.ErrReaderJSON)
+		})
+
+		t.Run("json reserved key", func(t *testing.T) {
+			for _, k := range []string{"name", "compressed_path", "git_object", "local_config"} {
+				r := bytes.NewBufferString(fmt.Sprintf(`{"path":%q,%q:"x"}`, f1, k))
+				w := walk.NewReader(r, walk.NewFile(nil), walk.WithJSON(true))
+				_, err := collectEntries(w.Walk(context.TODO(), ""))
+				assert.ErrorIs(t, err, walk.ErrReaderJSON, k)
+			}
+		})
+
+		t.Run("json not overwriting", func(t *testing.T) {
+			r := bytes.NewBufferString(fmt.Sprintf(`{"path":%q,"size":-1,"tag":"file"}`, f1))
+			w := walk.NewReader(r, walk.NewFile(nil), walk.WithJSON(true))
+			result, err := collectEntries(w.Walk(context.TODO(), ""))
+			assert.Nil(t, err)
+			if !assert.Len(t, result, 1) {
+				return
+			}
+			data := walk.NewMetaData(result[0])
+			for k, want := range map[string]any{
+				"size": result[0].Info().Size(),
+				"tag":  "file",
+			} {
+				got, _ := data.Get(k)
+				assert.Equal(t, want, got, k)
+			}
+		})
 	})
 
 	t.Run("FileWalker", func(t *testing.T) {
@@ -181,6 +270,15 @@ func TestWalker(t *testing.T) {
 					f2,
 				},
 			},
+			{
+				name:    "d exclude f3 by stat",
+				root:    d,
+				exclude: expr.New(expr.MustNewRaw(`name == "f3" && size == 0`)),
+				want: []string{
+					f1,
+					f2,
+				},
+			},
 			{
 				name: "d1",
 				root: d1,
@@ -188,20 +286,24 @@ func TestWalker(t *testing.T) {
 			},
 		} {
 			t.Run(tc.name, func(t *testing.T) {
-				w := walk.NewFile(tc.exclude)
-				r := slices.Collect(w.Walk(tc.root))
-				if !assert.Nil(t, w.Err()) {
-					t.Errorf("%#v", w.Err())
-				}
+				for _, parallel := range []int{1, 4} {
+					t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+						w := walk.NewFile(tc.exclude, walk.WithParallel(parallel))
+						r, err := collectEntries(w.Walk(context.TODO(), tc.root))
+						if !assert.Nil(t, err) {
+							t.Errorf("%#v", err)
+						}
 
-				got := make([]string, len(r))
-				for i, x := range r {
-					got[i] = x.Path()
-				}
+						got := make([]string, len(r))
+						for i, x := range r {
+							got[i] = x.Path()
+						}
 
-				slices.Sort(tc.want)
-				slices.Sort(got)
-				assert.Equal(t, tc.want, got)
+						slices.Sort(tc.want)
+						slices.Sort(got)
+						assert.Equal(t, tc.want, got)
+					})
+				}
 			})
 		}
 	})
@@ -255,9 +357,9 @@ func TestWalker(t *testing.T) {
 				t.Run(tc.title, func(t *testing.T) {
 					w := walk.NewZip(tc.exclude)
 
-					r := slices.Collect(w.Walk(zdest))
-					if !assert.Nil(t, w.Err()) {
-						t.Errorf("%#v", w.Err())
+					r, err := collectEntries(w.Walk(context.TODO(), zdest))
+					if !assert.Nil(t, err) {
+						t.Errorf("%#v", err)
 					}
 
 					got := make([]string, len(r))
@@ -272,4 +374,2642 @@ func TestWalker(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("Tar", func(t *testing.T) {
+		t.Run("init", func(t *testing.T) {
+			// troot
+			//  f1
+			//  d1
+			//    f2
+			//    d2
+			//      f3
+			mkdir(t, join("troot", "d1", "d2"))
+			touch(t, join("troot", "f1"))
+			touch(t, join("troot", "d1", "f2"))
+			touch(t, join("troot", "d1", "d2", "f3"))
+		})
+		for _, tc := range []struct {
+			title string
+			dest  string
+			flag  string
+		}{
+			{
+				title: "tar",
+				dest:  join("tdest.tar"),
+				flag:  "-cf",
+			},
+			{
+				title: "tar.gz",
+				dest:  join("tdest.tar.gz"),
+				flag:  "-czf",
+			},
+			{
+				title: "tar.bz2",
+				dest:  join("tdest.tar.bz2"),
+				flag:  "-cjf",
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				cmd := exec.Command("tar", tc.flag, tc.dest, "-C", d, "troot")
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				if !assert.Nil(t, cmd.Run()) {
+					return
+				}
+
+				for _, tc2 := range []struct {
+					title   string
+					exclude expr.Expr
+					want    []string
+				}{
+					{
+						title: "all",
+						want: []string{
+							filepath.Join(tc.dest, "troot", "f1"),
+							filepath.Join(tc.dest, "troot", "d1", "f2"),
+							filepath.Join(tc.dest, "troot", "d1", "d2", "f3"),
+						},
+					},
+					{
+						title:   "exclude d2",
+						exclude: expr.New(expr.MustNewRaw(`relpath == "troot/d1/d2/f3"`)),
+						want: []string{
+							filepath.Join(tc.dest, "troot", "f1"),
+							filepath.Join(tc.dest, "troot", "d1", "f2"),
+						},
+					},
+				} {
+					t.Run(tc2.title, func(t *testing.T) {
+						w := walk.NewTar(tc2.exclude)
+						r, err := collectEntries(w.Walk(context.TODO(), tc.dest))
+						if !assert.Nil(t, err) {
+							t.Errorf("%#v", err)
+						}
+						got := make([]string, len(r))
+						for i, x := range r {
+							got[i] = x.Path()
+							data := walk.NewMetaData(x)
+							root, _ := data.Get("root")
+							assert.Equal(t, tc.dest, root)
+							typeflag, _ := data.Get("typeflag")
+							assert.Equal(t, "0", typeflag)
+						}
+						slices.Sort(tc2.want)
+						slices.Sort(got)
+						assert.Equal(t, tc2.want, got)
+					})
+				}
+			})
+		}
+
+		t.Run("member names", func(t *testing.T) {
+			dest := join("tnames.tar")
+			var b bytes.Buffer
+			tw := tar.NewWriter(&b)
+			for _, name := range []string{
+				"./",
+				"./a.txt",
+				"../victim/v.txt",
+				"/abs.txt",
+				"x/../../y.txt",
+			} {
+				h := &tar.Header{
+					Name: name,
+					Mode: 0o644,
+				}
+				if strings.HasSuffix(name, "/") {
+					h.Typeflag = tar.TypeDir
+				}
+				if err := tw.WriteHeader(h); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dest, b.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			w := walk.NewTar(nil)
+			r, err := collectEntries(w.Walk(context.TODO(), dest))
+			assert.Nil(t, err)
+			if !assert.Len(t, r, 1) {
+				return
+			}
+			data := walk.NewMetaData(r[0])
+			assert.Equal(t, filepath.Join(dest, "a.txt"), r[0].Path())
+			relpath, _ := data.Get("relpath")
+			assert.Equal(t, "a.txt", relpath)
+			chain, _ := data.Get("archive_chain")
+			assert.Equal(t, dest+walk.ArchiveSep+"a.txt", chain)
+			e, ok := walk.EntryOf(data)
+			assert.True(t, ok)
+			assert.False(t, walk.IsOnFileSystem(e))
+
+			t.Run("on file system", func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), join("troot")))
+				assert.Nil(t, err)
+				for _, x := range r {
+					e, ok := walk.EntryOf(walk.NewMetaData(x))
+					assert.True(t, ok)
+					assert.True(t, walk.IsOnFileSystem(e), x.Path())
+				}
+				_, ok := walk.EntryOf(meta.NewData(map[string]any{"path": dest}))
+				assert.False(t, ok)
+			})
+		})
+	})
+
+	t.Run("Nest", func(t *testing.T) {
+		var (
+			nroot  = join("nroot")
+			nzip   = join("nroot", "lib", "inner.zip")
+			ntar   = join("nroot", "inner.tar.gz")
+			nouter = join("nouter.zip")
+		)
+		t.Run("init", func(t *testing.T) {
+			// nouter.zip
+			//   inner.tar.gz
+			//     lib/inner.zip
+			//       f1
+			//     f2
+			mkdir(t, join("nroot", "lib"))
+			touch(t, join("nroot", "f1"))
+			touch(t, join("nroot", "f2"))
+			for _, args := range [][]string{
+				{"zip", "-j", nzip, join("nroot", "f1")},
+				{"tar", "-czf", ntar, "-C", nroot, "lib/inner.zip", "f2"},
+				{"zip", "-j", nouter, ntar},
+			} {
+				cmd := exec.Command(args[0], args[1:]...)
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				assert.Nil(t, cmd.Run())
+			}
+		})
+		var (
+			chainTar = nouter + walk.ArchiveSep + "inner.tar.gz"
+			chainZip = chainTar + walk.ArchiveSep + "lib/inner.zip"
+		)
+		for _, tc := range []struct {
+			title string
+			opt   []walk.ArchiveOption
+			want  []string
+		}{
+			{
+				title: "no nest",
+				want: []string{
+					chainTar,
+				},
+			},
+			{
+				title: "depth 1",
+				opt: []walk.ArchiveOption{
+					walk.WithNestDepth(1),
+				},
+				want: []string{
+					chainTar,
+					chainTar + walk.ArchiveSep + "lib/inner.zip",
+					chainTar + walk.ArchiveSep + "f2",
+				},
+			},
+			{
+				title: "depth 2",
+				opt: []walk.ArchiveOption{
+					walk.WithNestDepth(2),
+				},
+				want: []string{
+					chainTar,
+					chainTar + walk.ArchiveSep + "lib/inner.zip",
+					chainTar + walk.ArchiveSep + "f2",
+					chainZip + walk.ArchiveSep + "f1",
+				},
+			},
+			{
+				title: "depth 2 spill",
+				opt: []walk.ArchiveOption{
+					walk.WithNestDepth(2),
+					walk.WithNestSize(0),
+				},
+				want: []string{
+					chainTar,
+					chainTar + walk.ArchiveSep + "lib/inner.zip",
+					chainTar + walk.ArchiveSep + "f2",
+					chainZip + walk.ArchiveSep + "f1",
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				w := walk.NewZip(nil, tc.opt...)
+				r, err := collectEntries(w.Walk(context.TODO(), nouter))
+				if !assert.Nil(t, err) {
+					t.Errorf("%#v", err)
+				}
+				got := make([]string, len(r))
+				for i, x := range r {
+					data := walk.NewMetaData(x)
+					chain, _ := data.Get("archive_chain")
+					got[i] = chain.(string)
+					depth, _ := data.Get("archive_depth")
+					assert.Equal(t, strings.Count(got[i], walk.ArchiveSep)-1, depth)
+				}
+				slices.Sort(tc.want)
+				slices.Sort(got)
+				assert.Equal(t, tc.want, got)
+			})
+		}
+	})
+
+	t.Run("FileWalkerArchive", func(t *testing.T) {
+		var (
+			aroot = join("aroot")
+			azip  = join("aroot", "a.zip")
+			atar  = join("aroot", "d", "a.tar")
+			af    = join("aroot", "f")
+		)
+		t.Run("init", func(t *testing.T) {
+			// aroot
+			//   f
+			//   a.zip
+			//     f
+			//   d
+			//     a.tar
+			//       f
+			mkdir(t, join("aroot", "d"))
+			touch(t, af)
+			for _, args := range [][]string{
+				{"zip", "-j", azip, af},
+				{"tar", "-cf", atar, "-C", aroot, "f"},
+			} {
+				cmd := exec.Command(args[0], args[1:]...)
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				assert.Nil(t, cmd.Run())
+			}
+		})
+		for _, tc := range []struct {
+			title   string
+			archive expr.Expr
+			exclude expr.Expr
+			want    []string
+		}{
+			{
+				title: "disabled",
+				want: []string{
+					af,
+					azip,
+					atar,
+				},
+			},
+			{
+				title:   "all archives",
+				archive: expr.New(expr.MustNewRaw(`true`)),
+				want: []string{
+					af,
+					join("aroot", "a.zip", "f"),
+					join("aroot", "d", "a.tar", "f"),
+				},
+			},
+			{
+				title:   "zip",
+				archive: expr.New(expr.MustNewRaw(`ext == ".zip"`)),
+				want: []string{
+					af,
+					join("aroot", "a.zip", "f"),
+					atar,
+				},
+			},
+			{
+				title:   "exclude in archive",
+				archive: expr.New(expr.MustNewRaw(`true`)),
+				exclude: expr.New(expr.MustNewRaw(`archive_parent == "` + atar + `"`)),
+				want: []string{
+					af,
+					join("aroot", "a.zip", "f"),
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				var opt []walk.FileOption
+				if tc.archive != nil {
+					opt = append(opt, walk.WithArchive(tc.archive))
+				}
+				w := walk.NewFile(tc.exclude, opt...)
+				r, err := collectEntries(w.Walk(context.TODO(), aroot))
+				if !assert.Nil(t, err) {
+					t.Errorf("%#v", err)
+				}
+				got := make([]string, len(r))
+				for i, x := range r {
+					got[i] = x.Path()
+				}
+				slices.Sort(tc.want)
+				slices.Sort(got)
+				assert.Equal(t, tc.want, got)
+			})
+		}
+	})
+
+	t.Run("RegistryWalker", func(t *testing.T) {
+		index := join("index.jsonl")
+		t.Run("init", func(t *testing.T) {
+			f, err := os.Create(index)
+			if !assert.Nil(t, err) {
+				return
+			}
+			fmt.Fprintln(f, `{"path":"/index/f1","name":"f1"}`)
+			fmt.Fprintln(f, `{"path":"/index/f2","name":"f2"}`)
+			f.Close()
+		})
+
+		registry := walk.NewRegistry()
+		registry.Register(walk.SchemeFile, walk.NewFile(nil))
+		registry.Register(walk.SchemeZip, walk.NewZip(nil))
+		registry.Register(walk.SchemeIndex, walk.NewIndex(expr.New(expr.MustNewRaw(`name == "f2"`))))
+
+		for _, tc := range []struct {
+			title string
+			root  string
+			want  []string
+			err   error
+		}{
+			{
+				title: "file",
+				root:  d2,
+				want: []string{
+					f1,
+				},
+			},
+			{
+				title: "file scheme",
+				root:  walk.NewRoot(walk.SchemeFile, d2),
+				want: []string{
+					f1,
+				},
+			},
+			{
+				title: "zip scheme",
+				root:  walk.NewRoot(walk.SchemeZip, join("zdest.zip")),
+				want: []string{
+					join("zdest.zip", join("zroot", "f1")),
+					join("zdest.zip", join("zroot", "d1", "f2")),
+					join("zdest.zip", join("zroot", "d2", "f3")),
+					join("zdest.zip", join("zroot", "d2", "d3", "f4")),
+				},
+			},
+			{
+				title: "index scheme",
+				root:  walk.NewRoot(walk.SchemeIndex, index),
+				want: []string{
+					"/index/f1",
+				},
+			},
+			{
+				title: "unknown scheme",
+				root:  walk.NewRoot("unknown", d2),
+				want:  []string{},
+				err:   walk.ErrUnknownScheme,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				w := walk.NewRegistryWalker(registry)
+				r, err := collectEntries(w.Walk(context.TODO(), tc.root))
+				if tc.err != nil {
+					assert.ErrorIs(t, err, tc.err)
+				} else if !assert.Nil(t, err) {
+					t.Errorf("%#v", err)
+				}
+				got := make([]string, len(r))
+				for i, x := range r {
+					got[i] = x.Path()
+					source, _ := walk.NewMetaData(x).Get("source")
+					assert.Equal(t, tc.root, source)
+				}
+				slices.Sort(tc.want)
+				slices.Sort(got)
+				assert.Equal(t, tc.want, got)
+			})
+		}
+	})
+
+	t.Run("FileWalkerError", func(t *testing.T) {
+		t.Run("not exist", func(t *testing.T) {
+			notExist := join("notexist")
+			t.Run("error", func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), notExist))
+				assert.Empty(t, r)
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			})
+			t.Run("entry", func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil, walk.WithErrorEntry(true)).Walk(context.TODO(), notExist))
+				assert.Nil(t, err)
+				if !assert.Len(t, r, 1) {
+					return
+				}
+				data := walk.NewMetaData(r[0])
+				assert.Equal(t, notExist, walk.GetPathFromMetadata(data))
+				errno, _ := data.Get("errno")
+				assert.Equal(t, int(syscall.ENOENT), errno)
+				_, ok := data.Get("error")
+				assert.True(t, ok)
+			})
+		})
+
+		t.Run("permission denied", func(t *testing.T) {
+			if os.Geteuid() == 0 {
+				t.Skip("root can read any directory")
+			}
+			var (
+				eroot = join("eroot")
+				e1    = join("eroot", "e1")
+				e2    = join("eroot", "e2")
+				f1    = join("eroot", "e1", "f")
+			)
+			mkdir(t, e1)
+			mkdir(t, e2)
+			touch(t, f1)
+			touch(t, join("eroot", "e2", "f"))
+			if err := os.Chmod(e2, 0); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chmod(e2, 0755)
+
+			t.Run("error", func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), eroot))
+				if assert.Len(t, r, 1) {
+					assert.Equal(t, f1, r[0].Path())
+				}
+				assert.ErrorIs(t, err, os.ErrPermission)
+			})
+			t.Run("entry", func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil, walk.WithErrorEntry(true)).Walk(context.TODO(), eroot))
+				assert.Nil(t, err)
+				got := map[string]any{}
+				for _, x := range r {
+					errno, _ := walk.NewMetaData(x).Get("errno")
+					got[x.Path()] = errno
+				}
+				assert.Equal(t, map[string]any{
+					f1: nil,
+					e2: int(syscall.EACCES),
+				}, got)
+			})
+		})
+	})
+
+	t.Run("FileWalkerSymlink", func(t *testing.T) {
+		// localroot/
+		//   real/
+		//     f
+		//     loop -> ..
+		//   link -> real
+		//   flink -> real/f
+		//   broken -> notexist
+		var (
+			lroot  = join("lroot")
+			rdir   = join("lroot", "real")
+			f      = join("lroot", "real", "f")
+			loop   = join("lroot", "real", "loop")
+			link   = join("lroot", "link")
+			flink  = join("lroot", "flink")
+			broken = join("lroot", "broken")
+		)
+		mkdir(t, rdir)
+		touch(t, f)
+		for _, x := range [][2]string{
+			{"..", loop},
+			{"real", link},
+			{filepath.Join("real", "f"), flink},
+			{"notexist", broken},
+		} {
+			if err := os.Symlink(x[0], x[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		realF, err := filepath.EvalSymlinks(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("metadata", func(t *testing.T) {
+			r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), lroot))
+			assert.Nil(t, err)
+			got := map[string][]any{}
+			for _, x := range r {
+				data := walk.NewMetaData(x)
+				var v []any
+				for _, k := range []string{"is_symlink", "link_target", "link_resolved", "link_broken"} {
+					y, _ := data.Get(k)
+					v = append(v, y)
+				}
+				got[x.Path()] = v
+			}
+			assert.Equal(t, map[string][]any{
+				f:      {false, "", "", false},
+				loop:   {true, "..", filepath.Dir(filepath.Dir(realF)), false},
+				link:   {true, "real", filepath.Dir(realF), false},
+				flink:  {true, filepath.Join("real", "f"), realF, false},
+				broken: {true, "notexist", "", true},
+			}, got)
+		})
+
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("follow parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(nil, walk.WithFollowSymlinks(true), walk.WithParallel(parallel))
+				r, err := collectEntries(w.Walk(context.TODO(), lroot))
+				assert.ErrorIs(t, err, walk.ErrSymlinkLoop)
+				got := make([]string, len(r))
+				for i, x := range r {
+					got[i] = x.Path()
+				}
+				slices.Sort(got)
+				assert.Equal(t, []string{
+					broken,
+					flink,
+					join("lroot", "link", "f"),
+					f,
+				}, got)
+			})
+		}
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		var (
+			mroot = join("mroot")
+			m1    = join("mroot", "m1")
+			m2    = join("mroot", "m2")
+			m3    = join("mroot", "m3")
+			m4    = join("mroot", "m4")
+		)
+		mkdir(t, mroot)
+		touch(t, m1)
+		touch(t, m2)
+		mkdir(t, m3)
+		if err := os.Symlink("m1", m4); err != nil {
+			t.Fatal(err)
+		}
+		for p, mode := range map[string]os.FileMode{
+			m1: 0644,
+			m2: 0757 | os.ModeSetuid,
+			m3: 0777 | os.ModeSticky,
+		} {
+			if err := os.Chmod(p, mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		keys := []string{"perm", "type", "setuid", "setgid", "sticky", "exec_user", "world_writable", "readable", "executable"}
+		get := func(t *testing.T, p string) map[string]any {
+			info, err := os.Lstat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := walk.NewMetaData(walk.NewEntry(p, info, walk.EntryAttrs{}))
+			got := map[string]any{}
+			for _, k := range keys {
+				got[k], _ = data.Get(k)
+			}
+			return got
+		}
+
+		for _, tc := range []struct {
+			path string
+			want []any
+		}{
+			{m1, []any{0644, "regular", false, false, false, false, false, true, false}},
+			{m2, []any{0757, "regular", true, false, false, true, true, true, true}},
+			{m3, []any{0777, "dir", false, false, true, true, true, true, true}},
+			{m4, []any{0777, "symlink", false, false, false, true, true, true, false}},
+		} {
+			t.Run(filepath.Base(tc.path), func(t *testing.T) {
+				want := map[string]any{}
+				for i, k := range keys {
+					want[k] = tc.want[i]
+				}
+				assert.Equal(t, want, get(t, tc.path))
+			})
+		}
+
+		t.Run("access only if referred", func(t *testing.T) {
+			info, err := os.Lstat(m1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := walk.NewMetaDataOf(walk.NewEntry(m1, info, walk.EntryAttrs{}), walk.ReferencesOf(expr.MustNewRaw(`perm == 0o644`)))
+			for _, k := range []string{"readable", "writable", "executable"} {
+				assert.NotContains(t, data.Unwrap(), k)
+			}
+			assert.Contains(t, data.Unwrap(), "perm")
+		})
+	})
+
+	t.Run("Xattr", func(t *testing.T) {
+		var (
+			xroot = join("xroot")
+			x1    = join("xroot", "x1")
+		)
+		mkdir(t, xroot)
+		touch(t, x1)
+		for k, v := range map[string]string{
+			"user.project": "p1",
+			"user.owner":   "o1",
+		} {
+			if err := walk.SetXattr(x1, k, v); err != nil {
+				t.Skipf("xattr is not supported: %v", err)
+			}
+		}
+
+		for _, tc := range []struct {
+			title string
+			opt   []walk.FileOption
+			want  any
+		}{
+			{
+				title: "disabled",
+			},
+			{
+				title: "all",
+				opt:   []walk.FileOption{walk.WithXattr(true, "")},
+				want: map[string]string{
+					"user.project": "p1",
+					"user.owner":   "o1",
+				},
+			},
+			{
+				title: "prefix",
+				opt:   []walk.FileOption{walk.WithXattr(true, "user.p")},
+				want: map[string]string{
+					"user.project": "p1",
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				r, err := collectEntries(walk.NewFile(nil, tc.opt...).Walk(context.TODO(), xroot))
+				assert.Nil(t, err)
+				if !assert.Len(t, r, 1) {
+					return
+				}
+				got, _ := walk.NewMetaData(r[0]).Get("xattr")
+				assert.Equal(t, tc.want, got)
+			})
+		}
+	})
+
+	t.Run("Mount", func(t *testing.T) {
+		t.Run("metadata", func(t *testing.T) {
+			if runtime.GOOS != "linux" {
+				t.Skip("mount metadata is available only on linux")
+			}
+			data := walk.NewMetaData(walk.NewEntry(f1, nil, walk.EntryAttrs{}))
+			mountPoint, _ := data.Get("mount_point")
+			if assert.IsType(t, "", mountPoint) {
+				assert.True(t, mountPoint == "/" || strings.HasPrefix(f1, mountPoint.(string)+"/"), mountPoint)
+			}
+			fsType, _ := data.Get("fs_type")
+			assert.NotEmpty(t, fsType)
+
+			// the same mount through the directory walk and the symlink
+			link := join("mountlink")
+			if err := os.Symlink(d3, link); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(link)
+			for _, parallel := range []int{1, 4} {
+				r, err := collectEntries(walk.NewFile(nil, walk.WithParallel(parallel)).Walk(context.TODO(), link+string(filepath.Separator)))
+				assert.Nil(t, err)
+				assert.NotEmpty(t, r)
+				for _, x := range r {
+					got, _ := walk.NewMetaData(x).Get("mount_point")
+					assert.Equal(t, mountPoint, got, x.Path())
+				}
+			}
+		})
+
+		t.Run("only if referred", func(t *testing.T) {
+			data := walk.NewMetaDataOf(walk.NewEntry(f1, nil, walk.EntryAttrs{}), walk.References{})
+			_, ok := data.Get("mount_point")
+			assert.False(t, ok)
+		})
+
+		t.Run("xdev", func(t *testing.T) {
+			r, err := collectEntries(walk.NewFile(nil, walk.WithXdev(true)).Walk(context.TODO(), d3))
+			assert.Nil(t, err)
+			got := make([]string, len(r))
+			for i, x := range r {
+				got[i] = x.Path()
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{f3, f2}, got)
+		})
+
+		t.Run("xdev other device", func(t *testing.T) {
+			// d3/d31 is on the other device
+			defer walk.SetFileDevice(func(info fs.FileInfo) (uint64, bool) {
+				if info.Name() == "d31" {
+					return 2, true
+				}
+				return 1, true
+			})()
+			for _, tc := range []struct {
+				title string
+				xdev  bool
+				want  []string
+			}{
+				{
+					title: "xdev",
+					xdev:  true,
+					want:  []string{f2},
+				},
+				{
+					title: "no xdev",
+					want:  []string{f3, f2},
+				},
+			} {
+				t.Run(tc.title, func(t *testing.T) {
+					r, err := collectEntries(walk.NewFile(nil, walk.WithXdev(tc.xdev)).Walk(context.TODO(), d3))
+					assert.Nil(t, err)
+					got := make([]string, len(r))
+					for i, x := range r {
+						got[i] = x.Path()
+					}
+					slices.Sort(got)
+					assert.Equal(t, tc.want, got)
+				})
+			}
+		})
+
+		const mountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid shared:2 - proc proc rw
+24 22 8:2 / /mnt/my\040disk rw,relatime shared:3 - ext4 /dev/sdb\0401 rw
+25 24 0:30 / /mnt/my\040disk/tmp rw - tmpfs tmpfs rw
+26 22 8:3 / /mnt/my\040disk rw,relatime shared:4 - xfs /dev/sdc1 rw
+bad line
+`
+
+		t.Run("parseMountInfo", func(t *testing.T) {
+			got, err := walk.ParseMountInfo(strings.NewReader(mountInfo))
+			assert.Nil(t, err)
+			assert.Equal(t, []walk.Mount{
+				{Point: "/", FSType: "ext4", Source: "/dev/sda1"},
+				{Point: "/proc", FSType: "proc", Source: "proc"},
+				{Point: "/mnt/my disk", FSType: "ext4", Source: "/dev/sdb 1"},
+				{Point: "/mnt/my disk/tmp", FSType: "tmpfs", Source: "tmpfs"},
+				{Point: "/mnt/my disk", FSType: "xfs", Source: "/dev/sdc1"},
+			}, got)
+		})
+
+		t.Run("unescapeMountInfo", func(t *testing.T) {
+			for _, tc := range []struct {
+				s    string
+				want string
+			}{
+				{s: "/mnt/a", want: "/mnt/a"},
+				{s: `/mnt/a\040b`, want: "/mnt/a b"},
+				{s: `/mnt/a\011b\012c\134d`, want: "/mnt/a\tb\nc\\d"},
+				{s: `/mnt/a\04`, want: `/mnt/a\04`},
+				{s: `/mnt/a\999`, want: `/mnt/a\999`},
+			} {
+				assert.Equal(t, tc.want, walk.UnescapeMountInfo(tc.s), tc.s)
+			}
+		})
+
+		t.Run("find", func(t *testing.T) {
+			for _, tc := range []struct {
+				path string
+				want string
+			}{
+				{path: "/", want: "/"},
+				{path: "/etc/hosts", want: "/"},
+				{path: "/proc/self", want: "/proc"},
+				{path: "/processes", want: "/"},
+				{path: "/mnt/my disk", want: "/mnt/my disk"},
+				{path: "/mnt/my disk/a", want: "/mnt/my disk"},
+				{path: "/mnt/my disk/tmp/a", want: "/mnt/my disk/tmp"},
+			} {
+				got, ok := walk.FindMount(strings.NewReader(mountInfo), tc.path)
+				assert.True(t, ok, tc.path)
+				assert.Equal(t, tc.want, got.Point, tc.path)
+			}
+			_, ok := walk.FindMount(strings.NewReader(mountInfo), "relative")
+			assert.False(t, ok)
+		})
+
+		t.Run("find later mount", func(t *testing.T) {
+			got, ok := walk.FindMount(strings.NewReader(mountInfo), "/mnt/my disk/b")
+			assert.True(t, ok)
+			assert.Equal(t, walk.Mount{Point: "/mnt/my disk", FSType: "xfs", Source: "/dev/sdc1"}, got)
+		})
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+		t.Run("metadata", func(t *testing.T) {
+			r, err := collectEntries(walk.NewFile(nil).Walk(context.TODO(), d))
+			assert.Nil(t, err)
+			var data *meta.Data
+			for _, x := range r {
+				if x.Path() == f3 {
+					data = walk.NewMetaData(x)
+				}
+			}
+			if !assert.NotNil(t, data) {
+				return
+			}
+			get := func(k string) any {
+				x, _ := data.Get(k)
+				return x
+			}
+			assert.Equal(t, d, get("root"))
+			assert.Equal(t, filepath.Join("d3", "d31", "f3"), get("relpath"))
+			assert.Equal(t, 3, get("depth"))
+			assert.Equal(t, []string{"d3", "d31", "f3"}, get("components"))
+		})
+
+		// droot/
+		//   e1
+		//   e2/
+		//     e3
+		//     e4/
+		//       e5
+		var (
+			droot = join("droot")
+			e1    = join("droot", "e1")
+			e3    = join("droot", "e2", "e3")
+			e5    = join("droot", "e2", "e4", "e5")
+		)
+		mkdir(t, join("droot", "e2", "e4"))
+		touch(t, e1)
+		touch(t, e3)
+		touch(t, e5)
+
+		for _, tc := range []struct {
+			title    string
+			minDepth int
+			maxDepth int
+			want     []string
+		}{
+			{
+				title:    "no limit",
+				maxDepth: -1,
+				want:     []string{e1, e3, e5},
+			},
+			{
+				title:    "max",
+				maxDepth: 2,
+				want:     []string{e1, e3},
+			},
+			{
+				title:    "min",
+				minDepth: 2,
+				maxDepth: -1,
+				want:     []string{e3, e5},
+			},
+			{
+				title:    "exact",
+				minDepth: 2,
+				maxDepth: 2,
+				want:     []string{e3},
+			},
+			{
+				title:    "root",
+				maxDepth: 0,
+				want:     []string{},
+			},
+		} {
+			for _, parallel := range []int{1, 4} {
+				t.Run(fmt.Sprintf("%s parallel %d", tc.title, parallel), func(t *testing.T) {
+					w := walk.NewFile(nil, walk.WithDepth(tc.minDepth, tc.maxDepth), walk.WithParallel(parallel))
+					r, err := collectEntries(w.Walk(context.TODO(), droot))
+					assert.Nil(t, err)
+					got := []string{}
+					for _, x := range r {
+						got = append(got, x.Path())
+					}
+					slices.Sort(got)
+					assert.Equal(t, tc.want, got)
+				})
+			}
+		}
+	})
+
+	t.Run("Gitignore", func(t *testing.T) {
+		// groot/
+		//   .git/info/exclude: secret
+		//   .gitignore: *.log, !keep.log, build/
+		//   a.log
+		//   keep.log
+		//   secret
+		//   main.go
+		//   build/
+		//     out
+		//   sub/
+		//     .ignore: *.go
+		//     sub.go
+		//     build
+		var (
+			groot = join("groot")
+			gjoin = func(p ...string) string { return filepath.Join(append([]string{groot}, p...)...) }
+			write = func(t *testing.T, p, s string) {
+				if err := os.WriteFile(p, []byte(s), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			gitignore = gjoin(".gitignore")
+			ignore    = gjoin("sub", ".ignore")
+		)
+		mkdir(t, gjoin(".git", "info"))
+		mkdir(t, gjoin("build"))
+		mkdir(t, gjoin("sub"))
+		write(t, gjoin(".git", "info", "exclude"), "secret\n")
+		write(t, gitignore, "# comment\n*.log\n!keep.log\nbuild/\n")
+		write(t, ignore, "*.go\n")
+		for _, x := range [][]string{
+			{"a.log"},
+			{"keep.log"},
+			{"secret"},
+			{"main.go"},
+			{"build", "out"},
+			{"sub", "sub.go"},
+			{"sub", "build"},
+		} {
+			touch(t, gjoin(x...))
+		}
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("prune parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(nil, walk.WithGitignore(walk.GitignorePrune), walk.WithParallel(parallel))
+				r, err := collectEntries(w.Walk(context.TODO(), groot))
+				assert.Nil(t, err)
+				got := []string{}
+				for _, x := range r {
+					got = append(got, x.Path())
+				}
+				slices.Sort(got)
+				assert.Equal(t, []string{
+					gitignore,
+					gjoin("keep.log"),
+					gjoin("main.go"),
+					ignore,
+					gjoin("sub", "build"),
+				}, got)
+			})
+		}
+
+		mark := func(t *testing.T, root string) map[string][]any {
+			t.Helper()
+			w := walk.NewFile(nil, walk.WithGitignore(walk.GitignoreMark))
+			r, err := collectEntries(w.Walk(context.TODO(), root))
+			assert.Nil(t, err)
+			got := map[string][]any{}
+			for _, x := range r {
+				data := walk.NewMetaData(x)
+				var v []any
+				for _, k := range []string{"ignored", "ignore_rule", "ignore_source"} {
+					y, _ := data.Get(k)
+					v = append(v, y)
+				}
+				got[x.Path()] = v
+			}
+			return got
+		}
+
+		t.Run("mark", func(t *testing.T) {
+			got := mark(t, groot)
+			assert.Equal(t, map[string][]any{
+				gitignore:              {false, "", ""},
+				gjoin("a.log"):         {true, "*.log", gitignore + ":2"},
+				gjoin("keep.log"):      {false, "!keep.log", gitignore + ":3"},
+				gjoin("secret"):        {true, "secret", gjoin(".git", "info", "exclude") + ":1"},
+				gjoin("main.go"):       {false, "", ""},
+				gjoin("build", "out"):  {true, "build/", gitignore + ":4"},
+				ignore:                 {false, "", ""},
+				gjoin("sub", "sub.go"): {true, "*.go", ignore + ":1"},
+				gjoin("sub", "build"):  {false, "", ""},
+			}, got)
+		})
+
+		t.Run("subdirectory", func(t *testing.T) {
+			touch(t, gjoin("sub", "secret"))
+			touch(t, gjoin("sub", "c.log"))
+			defer func() {
+				_ = os.Remove(gjoin("sub", "secret"))
+				_ = os.Remove(gjoin("sub", "c.log"))
+			}()
+			got := mark(t, gjoin("sub"))
+			assert.Equal(t, map[string][]any{
+				ignore:                 {false, "", ""},
+				gjoin("sub", "sub.go"): {true, "*.go", ignore + ":1"},
+				gjoin("sub", "build"):  {false, "", ""},
+				gjoin("sub", "secret"): {true, "secret", gjoin(".git", "info", "exclude") + ":1"},
+				gjoin("sub", "c.log"):  {true, "*.log", gitignore + ":2"},
+			}, got)
+		})
+
+		t.Run("ignored subdirectory", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithGitignore(walk.GitignorePrune))
+			r, err := collectEntries(w.Walk(context.TODO(), gjoin("build")))
+			assert.Nil(t, err)
+			assert.Empty(t, r)
+		})
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		// proot/
+		//   .git/config
+		//   a/node_modules/m
+		//   a/.DS_Store
+		//   a/main.bak
+		//   a/main.go
+		var (
+			proot = join("proot")
+			pjoin = func(p ...string) string { return filepath.Join(append([]string{proot}, p...)...) }
+		)
+		mkdir(t, pjoin(".git"))
+		mkdir(t, pjoin("a", "node_modules"))
+		for _, x := range [][]string{
+			{".git", "config"},
+			{"a", "node_modules", "m"},
+			{"a", ".DS_Store"},
+			{"a", "main.bak"},
+			{"a", "main.go"},
+		} {
+			touch(t, pjoin(x...))
+		}
+
+		patterns, err := walk.ResolvePresets([]string{"vcs", "deps", "os-junk", "backup"}, map[string][]string{
+			"backup": {"*.bak"},
+		})
+		if !assert.Nil(t, err) {
+			return
+		}
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(nil, walk.WithPrune(patterns), walk.WithParallel(parallel))
+				r, err := collectEntries(w.Walk(context.TODO(), proot))
+				assert.Nil(t, err)
+				got := []string{}
+				for _, x := range r {
+					got = append(got, x.Path())
+				}
+				assert.Equal(t, []string{pjoin("a", "main.go")}, got)
+			})
+		}
+
+		t.Run("unknown", func(t *testing.T) {
+			_, err := walk.ResolvePresets([]string{"vcs", "unknown"}, nil)
+			assert.ErrorIs(t, err, walk.ErrUnknownPreset)
+		})
+		t.Run("bad pattern", func(t *testing.T) {
+			_, err := walk.ResolvePresets([]string{"bad"}, map[string][]string{
+				"bad": {"["},
+			})
+			assert.ErrorIs(t, err, walk.ErrBadPattern)
+		})
+	})
+
+	t.Run("LocalConfig", func(t *testing.T) {
+		// localroot/
+		//   top.tmp
+		//   a/.mf.yaml  exclude .tmp
+		//   a/a.tmp
+		//   a/a.txt
+		//   a/b/.mf.yaml  exclude .txt
+		//   a/b/b.txt
+		//   a/b/b.md
+		var (
+			lroot = join("localroot")
+			ljoin = func(p ...string) string { return filepath.Join(append([]string{lroot}, p...)...) }
+			write = func(content string, p ...string) {
+				if err := os.WriteFile(ljoin(p...), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		mkdir(t, ljoin("a", "b"))
+		write(`exclude: ext == ".tmp"`, "a", walk.LocalConfigName)
+		write(`exclude: ext == ".txt" && size >= 0`, "a", "b", walk.LocalConfigName)
+		for _, x := range [][]string{
+			{"top.tmp"},
+			{"a", "a.tmp"},
+			{"a", "a.txt"},
+			{"a", "b", "b.txt"},
+			{"a", "b", "b.md"},
+		} {
+			touch(t, ljoin(x...))
+		}
+
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(nil, walk.WithLocalConfig(true), walk.WithParallel(parallel))
+				r, err := collectEntries(w.Walk(context.TODO(), lroot))
+				assert.Nil(t, err)
+				got := map[string][]string{}
+				for _, x := range r {
+					got[x.Path()] = x.LocalConfig()
+				}
+				var (
+					a = ljoin("a", walk.LocalConfigName)
+					b = ljoin("a", "b", walk.LocalConfigName)
+				)
+				assert.Equal(t, map[string][]string{
+					ljoin("top.tmp"):        nil,
+					a:                       {a},
+					ljoin("a", "a.txt"):     {a},
+					b:                       {a, b},
+					ljoin("a", "b", "b.md"): {a, b},
+				}, got)
+			})
+		}
+
+		t.Run("metadata", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithLocalConfig(true))
+			r, err := collectEntries(w.Walk(context.TODO(), ljoin("a", "b")))
+			assert.Nil(t, err)
+			for _, x := range r {
+				v, _ := walk.NewMetaData(x).Get("local_config")
+				assert.Equal(t, []string{ljoin("a", "b", walk.LocalConfigName)}, v, x.Path())
+			}
+		})
+
+		t.Run("invalid", func(t *testing.T) {
+			iroot := join("localroot-invalid")
+			mkdir(t, iroot)
+			if err := os.WriteFile(filepath.Join(iroot, walk.LocalConfigName), []byte(`exclude: "name =="`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			touch(t, filepath.Join(iroot, "f"))
+			w := walk.NewFile(nil, walk.WithLocalConfig(true))
+			_, err := collectEntries(w.Walk(context.TODO(), iroot))
+			assert.ErrorIs(t, err, walk.ErrLocalConfig)
+
+			t.Run("fixed for new walker", func(t *testing.T) {
+				if err := os.WriteFile(filepath.Join(iroot, walk.LocalConfigName), []byte(`exclude: name == "f"`), 0644); err != nil {
+					t.Fatal(err)
+				}
+				w := walk.NewFile(nil, walk.WithLocalConfig(true))
+				r, err := collectEntries(w.Walk(context.TODO(), iroot))
+				assert.Nil(t, err)
+				assert.Len(t, r, 1)
+			})
+		})
+	})
+
+	t.Run("Dirs", func(t *testing.T) {
+		// dirsroot/
+		//   f (3 bytes)
+		//   empty/
+		//   a/g (5 bytes)
+		//   a/b/h (7 bytes)
+		//   a/b/x.tmp
+		var (
+			droot = join("dirsroot")
+			djoin = func(p ...string) string { return filepath.Join(append([]string{droot}, p...)...) }
+			write = func(content string, p ...string) {
+				if err := os.WriteFile(djoin(p...), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			newest = time.Date(2030, 1, 2, 3, 4, 5, 0, time.Local)
+		)
+		mkdir(t, djoin("empty"))
+		mkdir(t, djoin("a", "b"))
+		write("fff", "f")
+		write("ggggg", "a", "g")
+		write("hhhhhhh", "a", "b", "h")
+		touch(t, djoin("a", "b", "x.tmp"))
+		if err := os.Chtimes(djoin("a", "b", "h"), newest, newest); err != nil {
+			t.Fatal(err)
+		}
+		exclude, err := expr.NewRaw(`ext == ".tmp"`)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		type stat struct {
+			entries, files, subdirs int
+			size                    int64
+		}
+		collect := func(t *testing.T, w walk.Walker) map[string]*stat {
+			r, err := collectEntries(w.Walk(context.TODO(), droot))
+			assert.Nil(t, err)
+			got := map[string]*stat{}
+			for _, x := range r {
+				if x.Dir() == nil {
+					got[x.Path()] = nil
+					continue
+				}
+				got[x.Path()] = &stat{
+					entries: x.Dir().EntryCount(),
+					files:   x.Dir().FileCount(),
+					subdirs: x.Dir().SubdirCount(),
+					size:    x.Dir().TotalSize(),
+				}
+				if x.Path() != djoin("empty") {
+					assert.True(t, x.Dir().NewestModTime().Equal(newest), x.Path())
+				}
+			}
+			return got
+		}
+
+		// parallel < 1 means 1
+		for _, parallel := range []int{-1, 0, 1, 4} {
+			t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(expr.New(exclude), walk.WithDirs(true), walk.WithParallel(parallel))
+				assert.Equal(t, map[string]*stat{
+					droot:                {entries: 3, files: 1, subdirs: 2, size: 15},
+					djoin("f"):           nil,
+					djoin("empty"):       {},
+					djoin("a"):           {entries: 2, files: 1, subdirs: 1, size: 12},
+					djoin("a", "g"):      nil,
+					djoin("a", "b"):      {entries: 1, files: 1, size: 7},
+					djoin("a", "b", "h"): nil,
+				}, collect(t, w))
+			})
+		}
+
+		t.Run("order", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithDirs(true))
+			r, err := collectEntries(w.Walk(context.TODO(), droot))
+			assert.Nil(t, err)
+			index := map[string]int{}
+			for i, x := range r {
+				index[x.Path()] = i
+			}
+			assert.Less(t, index[djoin("a", "b", "h")], index[djoin("a", "b")])
+			assert.Less(t, index[djoin("a", "b")], index[djoin("a")])
+			assert.Less(t, index[djoin("a")], index[droot])
+		})
+
+		t.Run("depth", func(t *testing.T) {
+			w := walk.NewFile(expr.New(exclude), walk.WithDirs(true), walk.WithDepth(1, 1))
+			assert.Equal(t, map[string]*stat{
+				djoin("f"):     nil,
+				djoin("empty"): nil,
+				djoin("a"):     nil,
+			}, collect(t, w))
+		})
+
+		t.Run("metadata", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithDirs(true), walk.WithDepth(0, 0))
+			r, err := collectEntries(w.Walk(context.TODO(), djoin("a", "b")))
+			assert.Nil(t, err)
+			if !assert.Len(t, r, 1) {
+				return
+			}
+			_, ok := walk.NewMetaData(r[0]).Get("entry_count")
+			assert.False(t, ok, "not descended")
+
+			w = walk.NewFile(nil, walk.WithDirs(true), walk.WithDepth(0, 1))
+			r, err = collectEntries(w.Walk(context.TODO(), djoin("a", "b")))
+			assert.Nil(t, err)
+			i := slices.IndexFunc(r, func(x walk.Entry) bool { return x.Path() == djoin("a", "b") })
+			if !assert.GreaterOrEqual(t, i, 0) {
+				return
+			}
+			data := walk.NewMetaData(r[i])
+			for k, v := range map[string]any{
+				"is_dir":       true,
+				"entry_count":  2,
+				"file_count":   2,
+				"subdir_count": 0,
+				"total_size":   int64(7),
+			} {
+				got, _ := data.Get(k)
+				assert.Equal(t, v, got, k)
+			}
+		})
+	})
+
+	t.Run("Parent", func(t *testing.T) {
+		// parentroot/
+		//   a/README.md
+		//   a/x.png
+		//   a/sub/
+		//   b/y.png
+		var (
+			proot = join("parentroot")
+			pjoin = func(p ...string) string { return filepath.Join(append([]string{proot}, p...)...) }
+		)
+		mkdir(t, pjoin("a", "sub"))
+		mkdir(t, pjoin("b"))
+		for _, x := range [][]string{
+			{"a", "README.md"},
+			{"a", "x.png"},
+			{"b", "y.png"},
+		} {
+			touch(t, pjoin(x...))
+		}
+
+		for _, parallel := range []int{1, 4} {
+			t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+				w := walk.NewFile(nil, walk.WithParent(true, []string{"README*", ".git"}), walk.WithParallel(parallel))
+				r, err := collectEntries(w.Walk(context.TODO(), proot))
+				assert.Nil(t, err)
+				got := map[string]walk.ParentEntry{}
+				for _, x := range r {
+					got[x.Path()] = x.Parent()
+				}
+				if !assert.Len(t, got, 3) {
+					return
+				}
+				a := got[pjoin("a", "x.png")]
+				assert.Same(t, a, got[pjoin("a", "README.md")], "shared by the entries")
+				assert.Equal(t, pjoin("a"), a.Path())
+				assert.Equal(t, 3, a.EntryCount())
+				assert.Equal(t, 2, a.FileCount())
+				assert.Equal(t, 1, a.SubdirCount())
+				assert.Equal(t, []string{"README.md", "sub", "x.png"}, a.Names())
+				assert.Equal(t, map[string]bool{"README*": true, ".git": false}, a.Markers())
+
+				b := got[pjoin("b", "y.png")]
+				assert.Equal(t, 1, b.EntryCount())
+				assert.Equal(t, map[string]bool{"README*": false, ".git": false}, b.Markers())
+			})
+		}
+
+		t.Run("metadata", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithParent(true, []string{"README*"}))
+			r, err := collectEntries(w.Walk(context.TODO(), pjoin("b")))
+			assert.Nil(t, err)
+			if !assert.Len(t, r, 1) {
+				return
+			}
+			v, _ := walk.NewMetaData(r[0]).Get("parent")
+			assert.Equal(t, map[string]any{
+				"path":         pjoin("b"),
+				"name":         "b",
+				"entry_count":  1,
+				"file_count":   1,
+				"subdir_count": 0,
+				"names":        []string{"y.png"},
+				"markers":      map[string]bool{"README*": false},
+			}, v)
+		})
+	})
+
+	t.Run("Decompress", func(t *testing.T) {
+		// gzroot/
+		//   app.log.1.gz  (named app.log in the header)
+		//   plain.gz      (no name in the header)
+		//   data.bz2
+		//   keep.txt
+		//   link.gz -> app.log.1.gz
+		var (
+			groot   = join("gzroot")
+			gjoin   = func(p ...string) string { return filepath.Join(append([]string{groot}, p...)...) }
+			modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			content = strings.Repeat("log line\n", 100)
+			gz      = func(name, headerName string) {
+				var b bytes.Buffer
+				gw := gzip.NewWriter(&b)
+				gw.Name = headerName
+				gw.ModTime = modTime
+				gw.Comment = "rotated"
+				if _, err := gw.Write([]byte(content)); err != nil {
+					t.Fatal(err)
+				}
+				if err := gw.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(gjoin(name), b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		mkdir(t, groot)
+		gz("app.log.1.gz", "app.log")
+		gz("plain.gz", "")
+		if err := os.WriteFile(gjoin("data"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := exec.Command("bzip2", gjoin("data")).Run(); err != nil {
+			t.Skipf("bzip2: %v", err)
+		}
+		touch(t, gjoin("keep.txt"))
+		if err := os.Symlink("app.log.1.gz", gjoin("link.gz")); err != nil {
+			t.Fatal(err)
+		}
+
+		w := walk.NewFile(nil, walk.WithDecompress(true))
+		r, err := collectEntries(w.Walk(context.TODO(), groot))
+		assert.Nil(t, err)
+		var (
+			got   = map[string]map[string]any{}
+			metas = map[string]*meta.Data{}
+		)
+		for _, x := range r {
+			data := walk.NewMetaData(x)
+			got[x.Path()] = data.Unwrap()
+			metas[x.Path()] = data
+		}
+		if !assert.Len(t, got, 5) {
+			return
+		}
+		assert.Contains(t, got, gjoin("keep.txt"))
+
+		for _, tc := range []struct {
+			path        string
+			name        string
+			root        string
+			compression string
+			comment     string
+		}{
+			{
+				path:        gjoin("app.log.1.gz", "app.log"),
+				name:        "app.log",
+				root:        gjoin("app.log.1.gz"),
+				compression: "gzip",
+				comment:     "rotated",
+			},
+			{
+				path:        gjoin("plain.gz", "plain"),
+				name:        "plain",
+				root:        gjoin("plain.gz"),
+				compression: "gzip",
+				comment:     "rotated",
+			},
+			{
+				path:        gjoin("link.gz", "app.log"),
+				name:        "app.log",
+				root:        gjoin("link.gz"),
+				compression: "gzip",
+				comment:     "rotated",
+			},
+			{
+				path:        gjoin("data.bz2", "data"),
+				name:        "data",
+				root:        gjoin("data.bz2"),
+				compression: "bzip2",
+			},
+		} {
+			t.Run(tc.path, func(t *testing.T) {
+				data, ok := got[tc.path]
+				if !assert.True(t, ok) {
+					return
+				}
+				assert.Equal(t, tc.name, data["name"])
+				assert.Equal(t, tc.root, data["root"])
+				assert.Equal(t, tc.name, data["relpath"])
+				assert.Equal(t, tc.compression, data["compression"])
+				assert.Equal(t, tc.comment, data["comment"])
+				assert.Equal(t, tc.root, data["compressed_path"])
+				assert.Equal(t, tc.root+walk.ArchiveSep+tc.name, data["archive_chain"])
+				if tc.compression == "gzip" {
+					assert.Equal(t, int64(len(content)), data["size"])
+					assert.Equal(t, uint64(len(content)), data["uncompressed_size"])
+					assert.Equal(t, modTime.Unix(), data["mod_time_ts"])
+					if stat, err := os.Stat(tc.root); assert.Nil(t, err) {
+						assert.Equal(t, uint64(stat.Size()), data["compressed_size"])
+					}
+					assert.Equal(t, "regular", data["type"])
+				} else {
+					// unknown without decompressing
+					assert.Equal(t, int64(-1), data["size"])
+					assert.NotContains(t, data, "uncompressed_size")
+				}
+
+				// the content is told by the entry, not by the metadata
+				data["compressed_path"] = "overwritten"
+				_, ok, _ = walk.OpenContent(context.TODO(), meta.NewData(data))
+				assert.False(t, ok)
+				rc, ok, err := walk.OpenContent(context.TODO(), metas[tc.path])
+				if !assert.Nil(t, err) || !assert.True(t, ok) {
+					return
+				}
+				defer rc.Close()
+				b, err := io.ReadAll(rc)
+				assert.Nil(t, err)
+				assert.Equal(t, content, string(b))
+			})
+		}
+
+		t.Run("exclude", func(t *testing.T) {
+			w := walk.NewFile(expr.New(expr.MustNewRaw(`compression == "gzip"`)), walk.WithDecompress(true))
+			r, err := collectEntries(w.Walk(context.TODO(), groot))
+			assert.Nil(t, err)
+			got := []string{}
+			for _, x := range r {
+				got = append(got, x.Path())
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{gjoin("data.bz2", "data"), gjoin("keep.txt")}, got)
+		})
+
+		t.Run("disabled", func(t *testing.T) {
+			w := walk.NewFile(nil)
+			r, err := collectEntries(w.Walk(context.TODO(), groot))
+			assert.Nil(t, err)
+			assert.Len(t, r, 5)
+			for _, x := range r {
+				assert.Nil(t, x.Compressed())
+			}
+		})
+	})
+
+	t.Run("Ar", func(t *testing.T) {
+		// debroot/
+		//   foo_1.0_amd64.deb
+		//     debian-binary
+		//     control.tar.gz
+		//       ./control
+		//     data.tar.xz
+		//       ./usr/bin/foo
+		//       ./usr/share/doc/foo/copyright
+		//   lib.ar
+		//     a.o
+		//     a_very_long_member_name.o  (GNU long name)
+		var (
+			droot   = join("debroot")
+			djoin   = func(p ...string) string { return filepath.Join(append([]string{droot}, p...)...) }
+			modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			newTar  = func(w io.Writer, files map[string]string) {
+				names := slices.Sorted(maps.Keys(files))
+				tw := tar.NewWriter(w)
+				for _, name := range names {
+					if err := tw.WriteHeader(&tar.Header{
+						Name:    name,
+						Mode:    0o755,
+						Size:    int64(len(files[name])),
+						ModTime: modTime,
+					}); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := tw.Write([]byte(files[name])); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := tw.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			arHeader = func(name string, size int) string {
+				return fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, modTime.Unix(), 1000, 1000, 0o644, size)
+			}
+			newAr = func(name string, files [][2]string) {
+				var b bytes.Buffer
+				b.WriteString("!<arch>\n")
+				for _, f := range files {
+					b.WriteString(arHeader(f[0], len(f[1])))
+					b.WriteString(f[1])
+					if len(f[1])%2 == 1 {
+						b.WriteString("\n")
+					}
+				}
+				if err := os.WriteFile(djoin(name), b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		mkdir(t, droot)
+		var control bytes.Buffer
+		gw := gzip.NewWriter(&control)
+		newTar(gw, map[string]string{
+			"./control": `Package: foo
+Version: 1.0
+Architecture: amd64
+Depends: libc6 (>= 2.34), libbar | libbaz
+Description: foo tool
+ Longer description.
+`,
+		})
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var data bytes.Buffer
+		xw, err := xz.NewWriter(&data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newTar(xw, map[string]string{
+			"./usr/bin/foo":                 "FOO",
+			"./usr/share/doc/foo/copyright": "COPYRIGHT",
+		})
+		if err := xw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		newAr("foo_1.0_amd64.deb", [][2]string{
+			{"debian-binary", "2.0\n"},
+			{"control.tar.gz", control.String()},
+			{"data.tar.xz", data.String()},
+		})
+		const longName = "a_very_long_member_name.o/\n"
+		newAr("lib.ar", [][2]string{
+			{"//", longName},
+			{"a.o/", "A"},
+			{"/0", "LONG"},
+		})
+		deb := djoin("foo_1.0_amd64.deb")
+
+		paths := func(r []walk.Entry) []string {
+			got := make([]string, len(r))
+			for i, x := range r {
+				got[i] = x.Path()
+			}
+			slices.Sort(got)
+			return got
+		}
+
+		t.Run("ar", func(t *testing.T) {
+			w := walk.NewAr(nil)
+			r, err := collectEntries(w.Walk(context.TODO(), djoin("lib.ar")))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				djoin("lib.ar", "a.o"),
+				djoin("lib.ar", "a_very_long_member_name.o"),
+			}, paths(r))
+			for _, x := range r {
+				data := walk.NewMetaData(x).Unwrap()
+				assert.Equal(t, djoin("lib.ar"), data["root"])
+				assert.Equal(t, x.Info().Name(), data["relpath"])
+				assert.Equal(t, 1000, data["uid"])
+				assert.Equal(t, modTime.Unix(), data["mod_time_ts"])
+				assert.Equal(t, 0o644, data["perm"])
+			}
+		})
+
+		t.Run("deb disabled", func(t *testing.T) {
+			w := walk.NewAr(nil)
+			r, err := collectEntries(w.Walk(context.TODO(), deb))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(deb, "control.tar.gz"),
+				filepath.Join(deb, "data.tar.xz"),
+				filepath.Join(deb, "debian-binary"),
+			}, paths(r))
+		})
+
+		t.Run("deb nest", func(t *testing.T) {
+			w := walk.NewAr(nil, walk.WithNestDepth(1))
+			r, err := collectEntries(w.Walk(context.TODO(), deb))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(deb, "control.tar.gz"),
+				filepath.Join(deb, "control.tar.gz", "control"),
+				filepath.Join(deb, "data.tar.xz"),
+				filepath.Join(deb, "data.tar.xz", "usr", "bin", "foo"),
+				filepath.Join(deb, "data.tar.xz", "usr", "share", "doc", "foo", "copyright"),
+				filepath.Join(deb, "debian-binary"),
+			}, paths(r))
+		})
+
+		t.Run("deb", func(t *testing.T) {
+			w := walk.NewAr(nil, walk.WithDeb(true))
+			r, err := collectEntries(w.Walk(context.TODO(), deb))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(deb, "usr", "bin", "foo"),
+				filepath.Join(deb, "usr", "share", "doc", "foo", "copyright"),
+			}, paths(r))
+			files := []string{}
+			for _, x := range r {
+				data := walk.NewMetaData(x).Unwrap()
+				files = append(files, data["deb_file"].(string))
+				assert.Equal(t, "foo", data["deb_package"])
+				assert.Equal(t, "1.0", data["deb_version"])
+				assert.Equal(t, "amd64", data["deb_architecture"])
+				assert.Equal(t, []string{"libc6 (>= 2.34)", "libbar | libbaz"}, data["deb_depends"])
+				assert.Equal(t, "foo tool\nLonger description.", data["deb_control"].(map[string]string)["Description"])
+				assert.Equal(t, deb, data["root"])
+				assert.Equal(t, deb+walk.ArchiveSep+data["relpath"].(string), data["archive_chain"])
+			}
+			slices.Sort(files)
+			assert.Equal(t, []string{"/usr/bin/foo", "/usr/share/doc/foo/copyright"}, files)
+		})
+
+		t.Run("deb exclude", func(t *testing.T) {
+			w := walk.NewAr(expr.New(expr.MustNewRaw(`deb_file startsWith "/usr/share/"`)), walk.WithDeb(true))
+			r, err := collectEntries(w.Walk(context.TODO(), deb))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{filepath.Join(deb, "usr", "bin", "foo")}, paths(r))
+		})
+
+		t.Run("FileWalker", func(t *testing.T) {
+			w := walk.NewFile(nil, walk.WithArchive(expr.New(expr.MustNewRaw(`ext == ".deb"`)), walk.WithDeb(true)))
+			r, err := collectEntries(w.Walk(context.TODO(), droot))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{
+				filepath.Join(deb, "usr", "bin", "foo"),
+				filepath.Join(deb, "usr", "share", "doc", "foo", "copyright"),
+				djoin("lib.ar"),
+			}, paths(r))
+		})
+
+		t.Run("bad magic", func(t *testing.T) {
+			bad := join("bad.ar")
+			if err := os.WriteFile(bad, []byte("not ar archive"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			w := walk.NewAr(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), bad))
+			assert.ErrorIs(t, err, walk.ErrArchive)
+		})
+	})
+
+	t.Run("Image", func(t *testing.T) {
+		// layer 0
+		//   etc/passwd
+		//   etc/secret.pem
+		//   app/a
+		//   app/sub/c
+		// layer 1
+		//   etc/.wh.secret.pem  deletes etc/secret.pem
+		//   etc/passwd          overwrites etc/passwd
+		//   app/.wh..wh..opq    deletes app/a and app/sub/c
+		//   app/b
+		type file struct {
+			name, content string
+			dir           bool
+		}
+		var (
+			iroot    = join("imageroot")
+			ijoin    = func(p ...string) string { return filepath.Join(append([]string{iroot}, p...)...) }
+			newLayer = func(files []file) []byte {
+				var b bytes.Buffer
+				tw := tar.NewWriter(&b)
+				for _, f := range files {
+					h := &tar.Header{
+						Name: f.name,
+						Mode: 0o644,
+						Size: int64(len(f.content)),
+					}
+					if f.dir {
+						h.Typeflag = tar.TypeDir
+						h.Mode = 0o755
+					}
+					if err := tw.WriteHeader(h); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := tw.Write([]byte(f.content)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := tw.Close(); err != nil {
+					t.Fatal(err)
+				}
+				return b.Bytes()
+			}
+			layer0 = newLayer([]file{
+				{name: "etc/", dir: true},
+				{name: "etc/passwd", content: "root"},
+				{name: "etc/secret.pem", content: "KEY"},
+				{name: "app/", dir: true},
+				{name: "app/a", content: "A"},
+				{name: "app/sub/c", content: "C"},
+			})
+			layer1 = newLayer([]file{
+				{name: "etc/.wh.secret.pem"},
+				{name: "etc/passwd", content: "root2"},
+				{name: "app/.wh..wh..opq"},
+				{name: "app/b", content: "B"},
+			})
+			digest = func(b []byte) string {
+				x := sha256.Sum256(b)
+				return "sha256:" + hex.EncodeToString(x[:])
+			}
+			mustJSON = func(v any) []byte {
+				b, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			}
+			writeFile = func(p string, b []byte) {
+				mkdir(t, filepath.Dir(p))
+				if err := os.WriteFile(p, b, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+
+		// OCI image layout
+		//   index.json -> image index -> manifest (linux/amd64) -> layer0 (gzip), layer1
+		//                             -> attestation manifest
+		ociDir := ijoin("oci")
+		writeBlob := func(b []byte) string {
+			d := digest(b)
+			alg, encoded, _ := strings.Cut(d, ":")
+			writeFile(filepath.Join(ociDir, "blobs", alg, encoded), b)
+			return d
+		}
+		var layer0gz bytes.Buffer
+		gw := gzip.NewWriter(&layer0gz)
+		if _, err := gw.Write(layer0); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			layer0Digest   = writeBlob(layer0gz.Bytes())
+			layer1Digest   = writeBlob(layer1)
+			configDigest   = writeBlob([]byte("{}"))
+			manifestDigest = writeBlob(mustJSON(map[string]any{
+				"schemaVersion": 2,
+				"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+				"config":        map[string]any{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": configDigest},
+				"layers": []map[string]any{
+					{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": layer0Digest},
+					{"mediaType": "application/vnd.oci.image.layer.v1.tar", "digest": layer1Digest},
+				},
+			}))
+			attestationDigest = writeBlob(mustJSON(map[string]any{
+				"schemaVersion": 2,
+				"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+				"layers": []map[string]any{
+					{"mediaType": "application/vnd.in-toto+json", "digest": configDigest},
+				},
+			}))
+			indexDigest = writeBlob(mustJSON(map[string]any{
+				"schemaVersion": 2,
+				"mediaType":     "application/vnd.oci.image.index.v1+json",
+				"manifests": []map[string]any{
+					{
+						"mediaType": "application/vnd.oci.image.manifest.v1+json",
+						"digest":    manifestDigest,
+						"platform":  map[string]any{"os": "linux", "architecture": "amd64"},
+					},
+					{
+						"mediaType": "application/vnd.oci.image.manifest.v1+json",
+						"digest":    attestationDigest,
+						"platform":  map[string]any{"os": "unknown", "architecture": "unknown"},
+					},
+				},
+			}))
+		)
+		writeFile(filepath.Join(ociDir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`))
+		writeFile(filepath.Join(ociDir, "index.json"), mustJSON(map[string]any{
+			"schemaVersion": 2,
+			"manifests": []map[string]any{
+				{
+					"mediaType":   "application/vnd.oci.image.index.v1+json",
+					"digest":      indexDigest,
+					"annotations": map[string]string{"io.containerd.image.name": "example:1"},
+				},
+			},
+		}))
+
+		// docker save
+		//   manifest.json
+		//   l0/layer.tar
+		//   l1/layer.tar -> ../x/layer.tar
+		dockerTar := ijoin("docker.tar")
+		{
+			var b bytes.Buffer
+			tw := tar.NewWriter(&b)
+			for _, f := range []struct {
+				name, link string
+				content    []byte
+			}{
+				{name: "manifest.json", content: mustJSON([]map[string]any{{
+					"Config":   "config.json",
+					"RepoTags": []string{"example:1"},
+					"Layers":   []string{"l0/layer.tar", "l1/layer.tar"},
+				}})},
+				{name: "config.json", content: []byte("{}")},
+				{name: "l0/layer.tar", content: layer0},
+				{name: "x/layer.tar", content: layer1},
+				{name: "l1/layer.tar", link: "../x/layer.tar"},
+			} {
+				h := &tar.Header{
+					Name: f.name,
+					Mode: 0o644,
+					Size: int64(len(f.content)),
+				}
+				if f.link != "" {
+					h.Typeflag = tar.TypeSymlink
+					h.Linkname = f.link
+				}
+				if err := tw.WriteHeader(h); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tw.Write(f.content); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(dockerTar, b.Bytes())
+		}
+
+		// the versions of the files by relpath
+		type version struct {
+			layer      int
+			shadowedBy int
+		}
+		want := map[string][]version{
+			"etc/passwd":     {{0, 1}, {1, -1}},
+			"etc/secret.pem": {{0, 1}},
+			"app/a":          {{0, 1}},
+			"app/sub/c":      {{0, 1}},
+			"app/b":          {{1, -1}},
+		}
+
+		for _, tc := range []struct {
+			title    string
+			root     string
+			platform string
+			digests  []string
+		}{
+			{
+				title:    "oci",
+				root:     ociDir,
+				platform: "linux/amd64",
+				digests:  []string{layer0Digest, layer1Digest},
+			},
+			{
+				title:   "docker",
+				root:    dockerTar,
+				digests: []string{digest(layer0), digest(layer1)},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				w := walk.NewImage(nil)
+				r, err := collectEntries(w.Walk(context.TODO(), tc.root))
+				if !assert.Nil(t, err) {
+					return
+				}
+				got := map[string][]version{}
+				for _, x := range r {
+					data := walk.NewMetaData(x).Unwrap()
+					relpath := data["relpath"].(string)
+					assert.Equal(t, filepath.Join(tc.root, relpath), x.Path())
+					assert.Equal(t, tc.root, data["root"])
+					assert.Equal(t, "example:1", data["image"])
+					assert.Equal(t, tc.platform, data["image_platform"])
+					layer := data["layer_index"].(int)
+					assert.Equal(t, tc.digests[layer], data["layer_digest"])
+					shadowedBy := -1
+					if data["layer_shadowed"].(bool) {
+						shadowedBy = slices.Index(tc.digests, data["layer_shadowed_by"].(string))
+					} else {
+						assert.Equal(t, "", data["layer_shadowed_by"])
+					}
+					got[relpath] = append(got[relpath], version{
+						layer:      layer,
+						shadowedBy: shadowedBy,
+					})
+				}
+				assert.Equal(t, want, got)
+			})
+		}
+
+		t.Run("final", func(t *testing.T) {
+			w := walk.NewImage(expr.New(expr.MustNewRaw(`layer_shadowed`)))
+			r, err := collectEntries(w.Walk(context.TODO(), ociDir))
+			assert.Nil(t, err)
+			got := []string{}
+			for _, x := range r {
+				got = append(got, x.Path())
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{
+				filepath.Join(ociDir, "app", "b"),
+				filepath.Join(ociDir, "etc", "passwd"),
+			}, got)
+		})
+
+		t.Run("not image", func(t *testing.T) {
+			w := walk.NewImage(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), ijoin("oci", "blobs")))
+			assert.ErrorIs(t, err, walk.ErrImage)
+		})
+
+		t.Run("invalid digest", func(t *testing.T) {
+			root := ijoin("oci-invalid")
+			writeFile(filepath.Join(root, "index.json"), mustJSON(map[string]any{
+				"schemaVersion": 2,
+				"manifests": []map[string]any{
+					{
+						"mediaType": "application/vnd.oci.image.manifest.v1+json",
+						"digest":    "sha256:../../../oci/index.json",
+					},
+				},
+			}))
+			w := walk.NewImage(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), root))
+			assert.ErrorIs(t, err, walk.ErrImage)
+		})
+
+		t.Run("invalid manifest path", func(t *testing.T) {
+			root := ijoin("docker-invalid")
+			writeFile(filepath.Join(root, "manifest.json"), mustJSON([]map[string]any{{
+				"Config": "config.json",
+				"Layers": []string{"../docker.tar"},
+			}}))
+			w := walk.NewImage(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), root))
+			assert.ErrorIs(t, err, walk.ErrImage)
+		})
+	})
+
+	t.Run("ISO", func(t *testing.T) {
+		// isosrc/
+		//   a.txt
+		//   dir/sub/LongFileName.txt
+		//   deep/1/2/3/4/5/6/7/8/f  (relocated by Rock Ridge)
+		//   link -> dir/sub/LongFileName.txt
+		var (
+			isrc    = join("isosrc")
+			ijoin   = func(p ...string) string { return filepath.Join(append([]string{isrc}, p...)...) }
+			modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			write   = func(content string, p ...string) {
+				mkdir(t, filepath.Dir(ijoin(p...)))
+				if err := os.WriteFile(ijoin(p...), []byte(content), 0o640); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(ijoin(p...), modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deep = filepath.Join("deep", "1", "2", "3", "4", "5", "6", "7", "8", "f")
+		)
+		if _, err := exec.LookPath("bsdtar"); err != nil {
+			t.Skipf("bsdtar: %v", err)
+		}
+		write("A", "a.txt")
+		write("LONG", "dir", "sub", "LongFileName.txt")
+		write("DEEP", deep)
+		if err := os.Symlink(filepath.Join("dir", "sub", "LongFileName.txt"), ijoin("link")); err != nil {
+			t.Fatal(err)
+		}
+		newISO := func(name, options string) string {
+			p := join(name)
+			args := []string{"-cf", p, "--format", "iso9660", "--options", options}
+			if !strings.HasPrefix(options, "rockridge") {
+				// too deep without Rock Ridge
+				args = append(args, "--exclude", "./deep")
+			}
+			cmd := exec.Command("bsdtar", append(args, "-C", isrc, ".")...)
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("bsdtar: %v", err)
+			}
+			return p
+		}
+
+		for _, tc := range []struct {
+			title     string
+			options   string
+			extension string
+			want      map[string]string
+		}{
+			{
+				title:     "rockridge",
+				options:   "rockridge,!joliet",
+				extension: "rockridge",
+				want: map[string]string{
+					"a.txt":                    "A",
+					"dir/sub/LongFileName.txt": "LONG",
+					filepath.ToSlash(deep):     "DEEP",
+					"link":                     "",
+				},
+			},
+			{
+				title:     "joliet",
+				options:   "!rockridge,joliet",
+				extension: "joliet",
+				want: map[string]string{
+					"a.txt":                    "A",
+					"dir/sub/LongFileName.txt": "LONG",
+				},
+			},
+			{
+				title:   "plain",
+				options: "!rockridge,!joliet",
+				want: map[string]string{
+					"A.TXT":                "A",
+					"DIR/SUB/LONGFILE.TXT": "LONG",
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				p := newISO(tc.title+".iso", tc.options)
+				w := walk.NewISO(nil)
+				r, err := collectEntries(w.Walk(context.TODO(), p))
+				if !assert.Nil(t, err) {
+					return
+				}
+				got := map[string]string{}
+				for _, x := range r {
+					data := walk.NewMetaData(x).Unwrap()
+					relpath := data["relpath"].(string)
+					got[relpath] = tc.want[relpath]
+					assert.Equal(t, filepath.Join(p, filepath.FromSlash(relpath)), x.Path())
+					assert.Equal(t, p, data["root"])
+					assert.Equal(t, tc.extension, data["iso_extension"])
+					assert.Equal(t, p+walk.ArchiveSep+relpath, data["archive_chain"])
+					if relpath == "link" {
+						assert.Equal(t, "dir/sub/LongFileName.txt", data["linkname"])
+						assert.Equal(t, "symlink", data["type"])
+						continue
+					}
+					assert.Equal(t, int64(len(tc.want[relpath])), data["size"])
+					if tc.extension == "rockridge" {
+						assert.Equal(t, modTime.Unix(), data["mod_time_ts"])
+						assert.Equal(t, modTime.Unix(), data["atime_ts"])
+						assert.Contains(t, data, "uid")
+					} else {
+						assert.NotContains(t, data, "uid")
+					}
+				}
+				assert.Equal(t, tc.want, got)
+			})
+		}
+
+		t.Run("exclude dir", func(t *testing.T) {
+			p := newISO("exclude.iso", "rockridge")
+			w := walk.NewISO(expr.New(expr.MustNewRaw(`is_dir && name == "sub"`)))
+			r, err := collectEntries(w.Walk(context.TODO(), p))
+			assert.Nil(t, err)
+			got := []string{}
+			for _, x := range r {
+				got = append(got, x.ISO().RelPath())
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{"a.txt", filepath.ToSlash(deep), "link"}, got)
+		})
+
+		t.Run("FileWalker", func(t *testing.T) {
+			p := newISO("filewalker.iso", "rockridge")
+			dir := join("isodir")
+			mkdir(t, dir)
+			if err := os.Rename(p, filepath.Join(dir, "x.iso")); err != nil {
+				t.Fatal(err)
+			}
+			w := walk.NewFile(nil, walk.WithArchive(expr.New(expr.MustNewRaw(`ext == ".iso"`))))
+			r, err := collectEntries(w.Walk(context.TODO(), dir))
+			assert.Nil(t, err)
+			assert.Len(t, r, 4)
+			for _, x := range r {
+				assert.NotNil(t, x.ISO())
+			}
+		})
+
+		t.Run("invalid name", func(t *testing.T) {
+			// the Rock Ridge names of ab and cd are rewritten to ".." and "/x"
+			src := join("isoinvalid")
+			mkdir(t, src)
+			for _, name := range []string{"ab", "cd", "ok.txt"} {
+				if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p := join("invalid.iso")
+			cmd := exec.Command("bsdtar", "-cf", p, "--format", "iso9660", "--options", "rockridge,!joliet", "-C", src, ".")
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("bsdtar: %v", err)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, bad := range map[string]string{"ab": "..", "cd": "/x"} {
+				nm := append([]byte{'N', 'M', 5 + byte(len(name)), 1, 0}, name...)
+				if !assert.Equal(t, 1, bytes.Count(b, nm), name) {
+					return
+				}
+				b = bytes.Replace(b, nm, append(nm[:5:5], bad...), 1)
+			}
+			if err := os.WriteFile(p, b, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			w := walk.NewISO(nil)
+			r, err := collectEntries(w.Walk(context.TODO(), p))
+			assert.Nil(t, err)
+			got := []string{}
+			for _, x := range r {
+				got = append(got, x.ISO().RelPath())
+				assert.Equal(t, filepath.Join(p, filepath.FromSlash(x.ISO().RelPath())), x.Path())
+			}
+			assert.Equal(t, []string{"ok.txt"}, got)
+		})
+
+		t.Run("not iso", func(t *testing.T) {
+			w := walk.NewISO(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), ijoin("a.txt")))
+			assert.ErrorIs(t, err, walk.ErrArchive)
+		})
+	})
+
+	t.Run("Git", func(t *testing.T) {
+		// gitrepo/
+		//   a.txt
+		//   bin/run.sh  (executable)
+		//   link -> a.txt
+		//   old.txt     (deleted by the 2nd commit)
+		var (
+			grepo = join("gitrepo")
+			gjoin = func(p ...string) string { return filepath.Join(append([]string{grepo}, p...)...) }
+			git   = func(arg ...string) string {
+				cmd := exec.Command("git", append([]string{"-C", grepo, "-c", "user.name=mf", "-c", "user.email=mf@example.com"}, arg...)...)
+				cmd.Stderr = os.Stderr
+				out, err := cmd.Output()
+				if err != nil {
+					t.Fatalf("git %v: %v", arg, err)
+				}
+				return strings.TrimSpace(string(out))
+			}
+			write = func(content string, perm os.FileMode, p ...string) {
+				mkdir(t, filepath.Dir(gjoin(p...)))
+				if err := os.WriteFile(gjoin(p...), []byte(content), perm); err != nil {
+					t.Fatal(err)
+				}
+			}
+		)
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skipf("git: %v", err)
+		}
+		mkdir(t, grepo)
+		git("init", "-q")
+		write("OLD", 0o644, "old.txt")
+		write("A1", 0o644, "a.txt")
+		git("add", ".")
+		git("commit", "-q", "-m", "first")
+		if err := os.Remove(gjoin("old.txt")); err != nil {
+			t.Fatal(err)
+		}
+		write("A2", 0o644, "a.txt")
+		write("#!/bin/sh\n", 0o755, "bin", "run.sh")
+		if err := os.Symlink("a.txt", gjoin("link")); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", "second")
+		// differs from the committed content
+		write("WORKTREE", 0o644, "a.txt")
+
+		for _, tc := range []struct {
+			title string
+			rev   string
+			want  map[string]string
+		}{
+			{
+				title: "head",
+				want: map[string]string{
+					"a.txt":      "A2",
+					"bin/run.sh": "#!/bin/sh\n",
+					"link":       "a.txt",
+				},
+			},
+			{
+				title: "revision",
+				rev:   "HEAD~1",
+				want: map[string]string{
+					"a.txt":   "A1",
+					"old.txt": "OLD",
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				root := grepo
+				if tc.rev != "" {
+					root += "@" + tc.rev
+				}
+				rev := tc.rev
+				if rev == "" {
+					rev = "HEAD"
+				}
+				commit := git("rev-parse", rev)
+				w := walk.NewGit(nil)
+				r, err := collectEntries(w.Walk(context.TODO(), root))
+				if !assert.Nil(t, err) {
+					return
+				}
+				got := map[string]string{}
+				for _, x := range r {
+					v := walk.NewMetaData(x)
+					data := v.Unwrap()
+					relpath := data["relpath"].(string)
+					assert.Equal(t, filepath.Join(root, filepath.FromSlash(relpath)), x.Path())
+					assert.Equal(t, grepo, data["root"])
+					assert.Equal(t, grepo, data["git_repo"])
+					assert.Equal(t, rev, data["git_revision"])
+					assert.Equal(t, commit, data["git_commit"])
+					assert.Equal(t, "blob", data["git_type"])
+					assert.Equal(t, git("rev-parse", rev+":"+relpath), data["git_object"])
+					assert.Equal(t, int64(len(tc.want[relpath])), data["size"])
+					switch relpath {
+					case "bin/run.sh":
+						assert.Equal(t, "100755", data["git_mode"])
+						assert.Equal(t, true, data["exec_user"])
+					case "link":
+						assert.Equal(t, "120000", data["git_mode"])
+						assert.Equal(t, "symlink", data["type"])
+					default:
+						assert.Equal(t, "100644", data["git_mode"])
+					}
+
+					rc, ok, err := walk.OpenContent(context.TODO(), v)
+					if !assert.Nil(t, err) || !assert.True(t, ok) {
+						continue
+					}
+					b, err := io.ReadAll(rc)
+					assert.Nil(t, err)
+					assert.Nil(t, rc.Close())
+					got[relpath] = string(b)
+				}
+				assert.Equal(t, tc.want, got)
+			})
+		}
+
+		t.Run("exclude", func(t *testing.T) {
+			w := walk.NewGit(expr.New(expr.MustNewRaw(`dir endsWith "bin"`)))
+			r, err := collectEntries(w.Walk(context.TODO(), grepo))
+			assert.Nil(t, err)
+			got := []string{}
+			for _, x := range r {
+				got = append(got, x.Git().RelPath())
+			}
+			slices.Sort(got)
+			assert.Equal(t, []string{"a.txt", "link"}, got)
+		})
+
+		t.Run("ParseGitRoot", func(t *testing.T) {
+			for _, tc := range []struct {
+				root string
+				repo string
+				rev  string
+			}{
+				{root: grepo, repo: grepo, rev: "HEAD"},
+				{root: grepo + "@v1", repo: grepo, rev: "v1"},
+				{root: grepo + "@HEAD@{1}", repo: grepo, rev: "HEAD@{1}"},
+			} {
+				repo, rev := walk.ParseGitRoot(tc.root)
+				assert.Equal(t, tc.repo, repo, tc.root)
+				assert.Equal(t, tc.rev, rev, tc.root)
+			}
+		})
+
+		t.Run("bad revision", func(t *testing.T) {
+			w := walk.NewGit(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), grepo+"@nosuchrev"))
+			assert.ErrorIs(t, err, walk.ErrGit)
+		})
+
+		t.Run("option revision", func(t *testing.T) {
+			out := join("git-output")
+			w := walk.NewGit(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), grepo+"@--output="+out))
+			assert.ErrorIs(t, err, walk.ErrGit)
+			_, err = os.Stat(out)
+			assert.True(t, os.IsNotExist(err))
+		})
+
+		t.Run("option object", func(t *testing.T) {
+			out := join("git-object-output")
+			info, err := os.Lstat(grepo)
+			if !assert.Nil(t, err) {
+				return
+			}
+			entry := walk.NewEntry(grepo, info, walk.EntryAttrs{
+				Git: walk.NewGitEntry(grepo, "HEAD", "", "a.txt", "100644", "blob", "--output="+out),
+			})
+			_, ok, err := walk.OpenGitBlob(context.TODO(), entry)
+			assert.True(t, ok)
+			assert.ErrorIs(t, err, walk.ErrGit)
+			_, err = os.Stat(out)
+			assert.True(t, os.IsNotExist(err))
+		})
+
+		t.Run("not repo", func(t *testing.T) {
+			dir := join("notgitrepo")
+			mkdir(t, dir)
+			w := walk.NewGit(nil)
+			_, err := collectEntries(w.Walk(context.TODO(), dir))
+			assert.ErrorIs(t, err, walk.ErrGit)
+		})
+	})
+
+	t.Run("ReferencesOf", func(t *testing.T) {
+		for _, tc := range []struct {
+			title string
+			exprs []any
+			want  walk.References
+		}{
+			{
+				title: "none",
+			},
+			{
+				title: "nil",
+				exprs: []any{nil},
+			},
+			{
+				title: "not referred",
+				exprs: []any{expr.MustNewRaw(`size > 0 && name == "btime"`)},
+			},
+			{
+				title: "birth time",
+				exprs: []any{expr.MustNewRaw(`size > 0`), expr.New(expr.MustNewRaw(`btime_ts > 0`))},
+				want:  walk.References{BirthTime: true},
+			},
+			{
+				title: "access",
+				exprs: []any{expr.MustNewRaw(`readable || executable`)},
+				want:  walk.References{Access: true},
+			},
+			{
+				title: "mount",
+				exprs: []any{expr.MustNewRaw(`fs_type == "tmpfs"`)},
+				want:  walk.References{Mount: true},
+			},
+			{
+				title: "union",
+				exprs: []any{expr.MustNewRaw(`writable`), expr.MustNewRaw(`btime != ""`), expr.MustNewRaw(`mount_point`)},
+				want:  walk.AllReferences,
+			},
+			{
+				title: "env",
+				exprs: []any{expr.MustNewRaw(`$env["btime"] != nil`)},
+				want:  walk.AllReferences,
+			},
+			{
+				title: "unknown",
+				exprs: []any{"size > 0"},
+				want:  walk.AllReferences,
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				assert.Equal(t, tc.want, walk.ReferencesOf(tc.exprs...))
+			})
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		for _, tc := range []struct {
+			title  string
+			walker func() walk.Walker
+			root   string
+		}{
+			{
+				title:  "file",
+				walker: func() walk.Walker { return walk.NewFile(nil) },
+				root:   d,
+			},
+			{
+				title:  "zip",
+				walker: func() walk.Walker { return walk.NewZip(nil) },
+				root:   join("zdest.zip"),
+			},
+			{
+				title:  "tar",
+				walker: func() walk.Walker { return walk.NewTar(nil) },
+				root:   join("tdest.tar"),
+			},
+			{
+				title: "reader",
+				walker: func() walk.Walker {
+					return walk.NewReader(bytes.NewBufferString(d), walk.NewFile(nil))
+				},
+			},
+		} {
+			t.Run(tc.title, func(t *testing.T) {
+				t.Run("canceled", func(t *testing.T) {
+					ctx, cancel := context.WithCancel(context.TODO())
+					cancel()
+					r, err := collectEntries(tc.walker().Walk(ctx, tc.root))
+					assert.Nil(t, err)
+					assert.Empty(t, r)
+				})
+				t.Run("break", func(t *testing.T) {
+					var n int
+					for _, err := range tc.walker().Walk(context.TODO(), tc.root) {
+						assert.Nil(t, err)
+						n++
+						break
+					}
+					assert.Equal(t, 1, n)
+				})
+			})
+		}
+	})
+}
+
+func TestParseRoot(t *testing.T) {
+	for _, tc := range []struct {
+		root   string
+		scheme string
+		path   string
+	}{
+		{
+			root:   "/data",
+			scheme: walk.SchemeFile,
+			path:   "/data",
+		},
+		{
+			root:   "file:///data",
+			scheme: walk.SchemeFile,
+			path:   "/data",
+		},
+		{
+			root:   "zip://a.zip",
+			scheme: walk.SchemeZip,
+			path:   "a.zip",
+		},
+		{
+			root:   "tar:///b:c.tgz",
+			scheme: walk.SchemeTar,
+			path:   "/b:c.tgz",
+		},
+		{
+			root:   "-",
+			scheme: walk.SchemeStdin,
+			path:   "-",
+		},
+	} {
+		t.Run(tc.root, func(t *testing.T) {
+			scheme, path := walk.ParseRoot(tc.root)
+			assert.Equal(t, tc.scheme, scheme)
+			assert.Equal(t, tc.path, path)
+		})
+	}
+}
+
+func BenchmarkFileWalker(b *testing.B) {
+	// 10 dirs * 10 dirs * 20 files
+	d := b.TempDir()
+	for i := range 10 {
+		for j := range 10 {
+			dir := filepath.Join(d, fmt.Sprintf("d%d", i), fmt.Sprintf("d%d", j))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				b.Fatal(err)
+			}
+			for k := range 20 {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", k)), nil, 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		title   string
+		exclude expr.Expr
+	}{
+		{
+			title: "no exclude",
+		},
+		{
+			title:   "exclude by path",
+			exclude: expr.New(expr.MustNewRaw(`name == "f0"`)),
+		},
+		{
+			title:   "exclude by stat",
+			exclude: expr.New(expr.MustNewRaw(`!is_dir && size > 0`)),
+		},
+	} {
+		b.Run(tc.title, func(b *testing.B) {
+			for _, parallel := range []int{1, 4, 16} {
+				b.Run(fmt.Sprintf("parallel %d", parallel), func(b *testing.B) {
+					w := walk.NewFile(tc.exclude, walk.WithParallel(parallel))
+					for b.Loop() {
+						for _, err := range w.Walk(context.TODO(), d) {
+							if err != nil {
+								b.Fatal(err)
+							}
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func collectEntries(seq iter.Seq2[walk.Entry, error]) ([]walk.Entry, error) {
+	var (
+		entries []walk.Entry
+		errs    []error
+	)
+	for x, err := range seq {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entries = append(entries, x)
+	}
+	return entries, errors.Join(errs...)
+}
+
+func TestParseDedup(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want walk.Dedup
+		err  error
+	}{
+		{s: "", want: walk.DedupNone},
+		{s: "path", want: walk.DedupPath},
+		{s: "inode", want: walk.DedupInode},
+		{s: "size", err: walk.ErrUnknownDedup},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := walk.ParseDedup(tc.s)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
 }
@@ -0,0 +1,72 @@
+//go:build linux
+
+package walk
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/berquerant/metafind/logx"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattr returns the extended attributes of path whose names start with prefix.
+// The attributes of the symlink itself are read unless follow is true.
+// The attributes failed to read, e.g. removed after listing or not permitted, are skipped.
+func readXattr(path, prefix string, follow bool) (map[string]string, error) {
+	var (
+		list = unix.Llistxattr
+		get  = unix.Lgetxattr
+	)
+	if follow {
+		list = unix.Listxattr
+		get = unix.Getxattr
+	}
+
+	names, err := readXattrBuffer(func(b []byte) (int, error) { return list(path, b) })
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{}
+	for _, name := range strings.Split(string(names), "\x00") {
+		if name == "" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		value, err := readXattrBuffer(func(b []byte) (int, error) { return get(path, name, b) })
+		if err != nil {
+			slog.Debug("readXattr", slog.String("path", path), slog.String("name", name), logx.Err(err))
+			continue
+		}
+		attrs[name] = string(value)
+	}
+	return attrs, nil
+}
+
+// readXattrBuffer calls f with the buffer of the size reported by f, retrying if the size changes.
+func readXattrBuffer(f func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := f(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		b := make([]byte, size)
+		n, err := f(b)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+
+// SetXattr sets the extended attribute of path.
+func SetXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
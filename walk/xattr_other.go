@@ -0,0 +1,21 @@
+//go:build !linux
+
+package walk
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var errXattrNotSupported = errors.New("XattrNotSupported")
+
+// readXattr is not available on this platform.
+func readXattr(_, _ string, _ bool) (map[string]string, error) {
+	return nil, fmt.Errorf("%w: %s", errXattrNotSupported, runtime.GOOS)
+}
+
+// SetXattr is not available on this platform.
+func SetXattr(_, _, _ string) error {
+	return fmt.Errorf("%w: %s", errXattrNotSupported, runtime.GOOS)
+}